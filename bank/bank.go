@@ -1,8 +1,12 @@
 package bank
 
 import (
+	"errors"
 	"fmt"
 	"log"
+	"strings"
+	"sync"
+	"sync/atomic"
 
 	"github.com/google/uuid"
 	"github.com/nats-io/nats.go"
@@ -17,13 +21,19 @@ type Bank struct {
 	Code           string         `yaml:"code"`
 	CountryCode    string         `yaml:"country_code"`
 	HomeCurrencies []CurrencyCode `yaml:"home_currencies"`
+	Capital        CurrencyValue  `yaml:"capital"`
+	Lending        Lending        `yaml:"lending"`
 
 	js          nats.JetStreamContext
 	service     micro.Service
 	accounts    nats.KeyValue
 	customers   nats.KeyValue
+	loans       nats.KeyValue
+	payments    nats.KeyValue
 	currencies  []Currency
 	currencyMap map[CurrencyCode]Currency
+	policyRate  *atomic.Int64
+	settlements *sync.Map
 }
 
 type AccountStatus string
@@ -34,22 +44,22 @@ const (
 )
 
 type Account struct {
-	UserID    uuid.UUID
-	AccountID uuid.UUID
-	Status    AccountStatus
-	Funds     map[CurrencyCode]Funds
+	UserID    uuid.UUID              `json:"user_id"`
+	AccountID uuid.UUID              `json:"account_id"`
+	Status    AccountStatus          `json:"status"`
+	Funds     map[CurrencyCode]Funds `json:"funds"`
 }
 
 type Funds struct {
-	TotalMinor     int
-	AvailableMinor int
-	OnHoldMinor    int
-	TotalMajor     int
-	AvailableMajor int
-	OnHoldMajor    int
-	Currency       CurrencyCode
-	MajorUnit      UnitType
-	MinorUnit      UnitType
+	TotalMinor     int          `json:"total_minor"`
+	AvailableMinor int          `json:"available_minor"`
+	OnHoldMinor    int          `json:"on_hold_minor"`
+	TotalMajor     int          `json:"total_major"`
+	AvailableMajor int          `json:"available_major"`
+	OnHoldMajor    int          `json:"on_hold_major"`
+	Currency       CurrencyCode `json:"currency"`
+	MajorUnit      UnitType     `json:"major_unit"`
+	MinorUnit      UnitType     `json:"minor_unit"`
 }
 
 type Availability string
@@ -77,6 +87,8 @@ func (b *Bank) Setup() {
 	}
 	b.currencies = currencies
 	b.currencyMap = cm
+	b.policyRate = &atomic.Int64{}
+	b.settlements = &sync.Map{}
 }
 
 func (b *Bank) Connect() {
@@ -89,9 +101,71 @@ func (b *Bank) Connect() {
 	if err != nil {
 		log.Fatalln(err)
 	}
+	loans, err := js.KeyValue(b.loanBucket())
+	if err != nil {
+		log.Fatalln(err)
+	}
+	payments, err := js.KeyValue(b.paymentBucket())
+	if err != nil {
+		log.Fatalln(err)
+	}
 	b.js = js
 	b.accounts = accounts
 	b.customers = customers
+	b.loans = loans
+	b.payments = payments
+	if err := b.openHouseAccount(); err != nil {
+		log.Fatalln(err)
+	}
+}
+
+// House is the bank's own account, used when the bank itself holds
+// securities or pays and receives money.
+func (b Bank) House() AccountRef {
+	return AccountRef{
+		CountryCode: b.CountryCode,
+		BankCode:    b.Code,
+		AccountID:   uuid.NewSHA1(uuid.NameSpaceOID, []byte(b.accountBucket())),
+	}
+}
+
+// SettlementAccount is the account the bank keeps for an institution such as
+// the central bank or the treasury to settle through. What is in it is not a
+// customer deposit.
+func (b Bank) SettlementAccount(institution string) AccountRef {
+	id := uuid.NewSHA1(uuid.NameSpaceOID, []byte(b.accountBucket()+"."+institution))
+	b.settlements.Store(id.String(), true)
+	return AccountRef{
+		CountryCode: b.CountryCode,
+		BankCode:    b.Code,
+		AccountID:   id,
+	}
+}
+
+func (b Bank) isSettlement(id string) bool {
+	if b.settlements == nil {
+		return false
+	}
+	_, ok := b.settlements.Load(id)
+	return ok
+}
+
+func (b Bank) openHouseAccount() error {
+	id := b.House().AccountID
+	if _, err := b.getAccount(id); err == nil {
+		return nil
+	}
+	if _, err := b.newAccount(id); err != nil {
+		return err
+	}
+	if b.Capital.Currency == "" {
+		return nil
+	}
+	capital, err := b.Capital.Convert(Minor)
+	if err != nil {
+		return err
+	}
+	return b.deposit(id, b.Capital.Currency, capital)
 }
 
 func (b Bank) Init() {
@@ -108,24 +182,106 @@ func (b Bank) Init() {
 	if err != nil {
 		log.Fatalln(err)
 	}
+	_, err = js.CreateKeyValue(&nats.KeyValueConfig{
+		Bucket: b.loanBucket(),
+	})
+	if err != nil {
+		log.Fatalln(err)
+	}
+	_, err = js.CreateKeyValue(&nats.KeyValueConfig{
+		Bucket: b.paymentBucket(),
+		TTL:    paymentTTL,
+	})
+	if err != nil {
+		log.Fatalln(err)
+	}
 }
 
 func (b Bank) newAccount(id uuid.UUID) (Account, error) {
 	if id == uuid.Nil {
 		return Account{}, fmt.Errorf("error adding user: cannot have nil user id")
 	}
-	account := Account{}
+	account := Account{
+		UserID:    id,
+		AccountID: id,
+		Status:    Active,
+	}
 	for _, c := range b.currencies {
-		if err := b.put(id, c.Code, Available, 0); err != nil {
+		if err := b.create(id, c.Code, Available, 0); err != nil {
+			return Account{}, err
+		}
+		if err := b.create(id, c.Code, OnHold, 0); err != nil {
+			return Account{}, err
+		}
+	}
+	return account, nil
+}
+
+// openAccount opens a new account for a customer and adds it to the
+// customer's accounts.
+func (b Bank) openAccount(owner uuid.UUID) (Account, error) {
+	if owner == uuid.Nil {
+		return Account{}, fmt.Errorf("error opening account: cannot have nil user id")
+	}
+	id := uuid.New()
+	if _, err := b.newAccount(id); err != nil {
+		return Account{}, err
+	}
+	if err := b.addCustomerAccount(owner, id); err != nil {
+		return Account{}, err
+	}
+	return b.account(id)
+}
+
+// account is an account's funds with its owner and status. Accounts opened
+// by a deposit rather than for a customer belong to themselves.
+func (b Bank) account(id uuid.UUID) (Account, error) {
+	account, err := b.getAccount(id)
+	if err != nil {
+		return Account{}, err
+	}
+	account.UserID = id
+	account.Status = Active
+	keys, err := b.customerKeys(fmt.Sprintf("*.%s", id))
+	if err != nil {
+		return Account{}, err
+	}
+	for _, key := range keys {
+		owner, err := uuid.Parse(strings.Split(key, ".")[0])
+		if err != nil {
 			return Account{}, err
 		}
-		if err := b.put(id, c.Code, OnHold, 0); err != nil {
-			return Account{}, nil
+		status, err := b.customerAccountStatus(owner, id)
+		if err != nil {
+			return Account{}, err
 		}
+		account.UserID = owner
+		account.Status = status
 	}
 	return account, nil
 }
 
+// ownerAccounts are all the accounts a customer has opened.
+func (b Bank) ownerAccounts(owner uuid.UUID) ([]Account, error) {
+	keys, err := b.customerKeys(fmt.Sprintf("%s.*", owner))
+	if err != nil {
+		return nil, err
+	}
+	accounts := []Account{}
+	for _, key := range keys {
+		id, err := uuid.Parse(strings.Split(key, ".")[1])
+		if err != nil {
+			return nil, err
+		}
+		account, err := b.account(id)
+		if err != nil {
+			return nil, err
+		}
+		accounts = append(accounts, account)
+	}
+	return accounts, nil
+}
+
 func (b Bank) getAccount(id uuid.UUID) (Account, error) {
 	fundMap := map[CurrencyCode]Funds{}
 	for _, c := range b.currencies {
@@ -145,6 +301,8 @@ func (b Bank) getAccount(id uuid.UUID) (Account, error) {
 			AvailableMajor: (available) / c.MajorUnit.MinorRatio,
 			OnHoldMajor:    (onHold) / c.MajorUnit.MinorRatio,
 			Currency:       c.Code,
+			MajorUnit:      Major,
+			MinorUnit:      Minor,
 		}
 	}
 	account := Account{
@@ -154,43 +312,106 @@ func (b Bank) getAccount(id uuid.UUID) (Account, error) {
 	return account, nil
 }
 
+// transfer moves money from one account to another. The debit and credit
+// each apply atomically, and if the credit fails the debit is put back. The
+// two balances are separate keys, so the transfer as a whole is not atomic:
+// between the debit and the credit the money is in neither account, and if
+// the bank stops in that window it is lost. A transfer sent with a reference
+// is left pending in the payments bucket then, which shows where to look.
 func (b Bank) transfer(give, recv uuid.UUID, code CurrencyCode, sum int, fromOnHold bool) error {
 	status := Available
 	if fromOnHold {
 		status = OnHold
 	}
-	current, err := b.get(give, code, status)
-	remainder := current - sum
-	if err != nil {
-		return err
-	}
-	if remainder < 0 {
-		return fmt.Errorf("transfer failed: insufficient funds")
-	}
-
-	if err := b.put(give, code, status, remainder); err != nil {
+	if err := b.debit(give, code, status, sum, "transfer failed: insufficient funds"); err != nil {
 		return err
 	}
-	if err := b.put(recv, code, Available, sum); err != nil {
+	if err := b.deposit(recv, code, sum); err != nil {
+		if err := b.credit(give, code, status, sum); err != nil {
+			log.Println(err)
+		}
 		return err
 	}
 	return nil
 }
 
-func (b Bank) hold(user uuid.UUID, code CurrencyCode, sum int) error {
-	current, err := b.get(user, code, Available)
-	remainder := current - sum
+func (b Bank) debit(id uuid.UUID, code CurrencyCode, status Availability, sum int, insufficient string) error {
+	return b.update(id, code, status, false, func(current int) (int, error) {
+		if current-sum < 0 {
+			return 0, errors.New(insufficient)
+		}
+		return current - sum, nil
+	})
+}
+
+func (b Bank) credit(id uuid.UUID, code CurrencyCode, status Availability, sum int) error {
+	return b.update(id, code, status, false, func(current int) (int, error) {
+		return current + sum, nil
+	})
+}
+
+// TotalDeposits sums what the bank's customers hold in a currency, not
+// counting the bank's own house account or its settlement accounts.
+func (b Bank) TotalDeposits(code CurrencyCode) (int, error) {
+	keys, err := b.accounts.Keys()
+	if errors.Is(err, nats.ErrNoKeysFound) {
+		return 0, nil
+	}
 	if err != nil {
+		return 0, err
+	}
+	house := b.House().AccountID.String()
+	sum := 0
+	for _, key := range keys {
+		parts := strings.Split(key, ".")
+		if len(parts) != 3 || parts[0] == house || parts[1] != string(code) || b.isSettlement(parts[0]) {
+			continue
+		}
+		id, err := uuid.Parse(parts[0])
+		if err != nil {
+			continue
+		}
+		v, err := b.get(id, code, Availability(parts[2]))
+		if err != nil {
+			return 0, err
+		}
+		sum += v
+	}
+	return sum, nil
+}
+
+// Reserves is what the bank itself holds in a currency.
+func (b Bank) Reserves(code CurrencyCode) (int, error) {
+	return b.get(b.House().AccountID, code, Available)
+}
+
+// deposit adds to an account's available funds, opening the account if it
+// does not exist yet.
+func (b Bank) deposit(id uuid.UUID, code CurrencyCode, sum int) error {
+	err := b.credit(id, code, Available, sum)
+	if !errors.Is(err, nats.ErrKeyNotFound) {
 		return err
 	}
-	if remainder < 0 {
-		return fmt.Errorf("hold failed: insufficient available securities to put on hold")
+	if _, err := b.newAccount(id); err != nil {
+		return err
 	}
+	return b.credit(id, code, Available, sum)
+}
+
+func (b Bank) withdraw(id uuid.UUID, code CurrencyCode, sum int) error {
+	return b.debit(id, code, Available, sum, "withdrawal failed: insufficient funds")
+}
 
-	if err := b.put(user, code, Available, remainder); err != nil {
+// hold moves available funds on hold. If they cannot be put on hold they are
+// made available again.
+func (b Bank) hold(user uuid.UUID, code CurrencyCode, sum int) error {
+	if err := b.debit(user, code, Available, sum, "hold failed: insufficient available securities to put on hold"); err != nil {
 		return err
 	}
-	if err := b.put(user, code, OnHold, sum); err != nil {
+	if err := b.credit(user, code, OnHold, sum); err != nil {
+		if err := b.credit(user, code, Available, sum); err != nil {
+			log.Println(err)
+		}
 		return err
 	}
 	return nil
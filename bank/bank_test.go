@@ -1,7 +1,15 @@
 package bank
 
 import (
+	"encoding/json"
+	"sync"
 	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/nats-io/nats-server/v2/server"
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/micro"
 )
 
 // func (b Bank) ConvertCurrency(code CurrencyCode, from, to UnitType, sum int) (int, error)
@@ -81,3 +89,421 @@ func TestMatchingOrder(t *testing.T) {
 		})
 	}
 }
+
+func testBank(t *testing.T) Bank {
+	t.Helper()
+	opts := &server.Options{
+		Host:      "127.0.0.1",
+		Port:      -1,
+		JetStream: true,
+		StoreDir:  t.TempDir(),
+		NoLog:     true,
+		NoSigs:    true,
+	}
+	ns, err := server.NewServer(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go ns.Start()
+	if !ns.ReadyForConnections(5 * time.Second) {
+		t.Fatal("nats server not ready")
+	}
+	t.Cleanup(ns.Shutdown)
+	nc, err := nats.Connect(ns.ClientURL())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(nc.Close)
+	js, err := nc.JetStream()
+	if err != nil {
+		t.Fatal(err)
+	}
+	accounts, err := js.CreateKeyValue(&nats.KeyValueConfig{Bucket: "test_accounts"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	customers, err := js.CreateKeyValue(&nats.KeyValueConfig{Bucket: "test_customers"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	loans, err := js.CreateKeyValue(&nats.KeyValueConfig{Bucket: "test_loans"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	payments, err := js.CreateKeyValue(&nats.KeyValueConfig{Bucket: "test_payments"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := Bank{accounts: accounts, customers: customers, loans: loans, payments: payments}
+	b.Setup()
+	return b
+}
+
+func TestConcurrentTransfersConserveMoney(t *testing.T) {
+	b := testBank(t)
+	const (
+		code      CurrencyCode = "USD"
+		customers              = 5
+		opening                = 1000
+		workers                = 20
+		rounds                 = 25
+	)
+	ids := make([]uuid.UUID, customers)
+	for i := range ids {
+		ids[i] = uuid.New()
+		if err := b.deposit(ids[i], code, opening); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for r := 0; r < rounds; r++ {
+				give := ids[(w+r)%customers]
+				recv := ids[(w+2*r+1)%customers]
+				// Insufficient funds are expected; only conservation matters.
+				_ = b.transfer(give, recv, code, 1+(w*r)%300, false)
+				_ = b.hold(give, code, 1+r%7)
+				_ = b.transfer(give, recv, code, 1+r%5, true)
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	total := 0
+	for _, id := range ids {
+		account, err := b.getAccount(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		funds := account.Funds[code]
+		if funds.AvailableMinor < 0 || funds.OnHoldMinor < 0 {
+			t.Errorf("%s has a negative balance: %+v", id, funds)
+		}
+		total += funds.TotalMinor
+	}
+	if total != customers*opening {
+		t.Errorf("money was not conserved: got %d, want %d", total, customers*opening)
+	}
+}
+
+func TestDepositOpensAccountOnce(t *testing.T) {
+	b := testBank(t)
+	id := uuid.New()
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := b.deposit(id, "USD", 10); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	got, err := b.get(id, "USD", Available)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != 100 {
+		t.Errorf("got %d, want 100", got)
+	}
+}
+
+func TestCustomerAccounts(t *testing.T) {
+	b := testBank(t)
+	owner := uuid.New()
+	none, err := b.ownerAccounts(owner)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(none) != 0 {
+		t.Fatalf("got %d accounts before opening any", len(none))
+	}
+	first, err := b.openAccount(owner)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := b.openAccount(owner)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.AccountID == owner || first.AccountID == second.AccountID {
+		t.Fatalf("account ids not generated: %s %s", first.AccountID, second.AccountID)
+	}
+	if err := b.cancelCustomerAccount(owner, second.AccountID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := b.openAccount(uuid.New()); err != nil {
+		t.Fatal(err)
+	}
+
+	accounts, err := b.ownerAccounts(owner)
+	if err != nil {
+		t.Fatal(err)
+	}
+	statuses := map[uuid.UUID]AccountStatus{}
+	for _, a := range accounts {
+		if a.UserID != owner {
+			t.Errorf("account %s owned by %s, want %s", a.AccountID, a.UserID, owner)
+		}
+		statuses[a.AccountID] = a.Status
+	}
+	if len(statuses) != 2 || statuses[first.AccountID] != Active || statuses[second.AccountID] != Cancelled {
+		t.Errorf("got accounts %v", statuses)
+	}
+
+	account, err := b.account(first.AccountID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if account.UserID != owner || account.Funds["USD"].TotalMinor != 0 {
+		t.Errorf("got account %+v", account)
+	}
+}
+
+// fakeRequest records what a handler responds with.
+type fakeRequest struct {
+	micro.Request
+	response []byte
+}
+
+func (r *fakeRequest) Respond(data []byte, _ ...micro.RespondOpt) error {
+	r.response = data
+	return nil
+}
+
+func (r *fakeRequest) RespondJSON(v any, _ ...micro.RespondOpt) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	r.response = data
+	return nil
+}
+
+func (r *fakeRequest) status(t *testing.T) Response {
+	t.Helper()
+	resp := Response{}
+	if err := json.Unmarshal(r.response, &resp); err != nil {
+		t.Fatal(err)
+	}
+	return resp
+}
+
+func TestAdminRejectsNonPositiveSums(t *testing.T) {
+	b := testBank(t)
+	id := uuid.New()
+	if err := b.deposit(id, "USD", 1000); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name string
+		call func(micro.Request, int)
+	}{
+		{
+			name: "deposit",
+			call: func(req micro.Request, sum int) {
+				b.AdminDeposit(req, Deposit{AccountID: id, Currency: "USD", Unit: Minor, Sum: sum})
+			},
+		},
+		{
+			name: "withdraw",
+			call: func(req micro.Request, sum int) {
+				b.AdminWithdraw(req, Withdrawal{AccountID: id, Currency: "USD", Unit: Minor, Sum: sum})
+			},
+		},
+		{
+			name: "hold",
+			call: func(req micro.Request, sum int) {
+				b.AdminHold(req, Hold{AccountID: id, Currency: "USD", Unit: Minor, Sum: sum})
+			},
+		},
+		{
+			name: "transfer",
+			call: func(req micro.Request, sum int) {
+				b.AdminTransfer(req, Transfer{From: id, To: uuid.New(), Currency: "USD", Unit: Minor, Sum: sum})
+			},
+		},
+	}
+	for _, tt := range tests {
+		for _, sum := range []int{0, -500} {
+			t.Run(tt.name, func(t *testing.T) {
+				req := &fakeRequest{}
+				tt.call(req, sum)
+				if resp := req.status(t); resp.Status != "Error" {
+					t.Errorf("sum %d: got %+v, want an error", sum, resp)
+				}
+				account, err := b.getAccount(id)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if funds := account.Funds["USD"]; funds.AvailableMinor != 1000 || funds.OnHoldMinor != 0 {
+					t.Errorf("sum %d changed the balance: %+v", sum, funds)
+				}
+			})
+		}
+	}
+}
+
+func TestTotalDepositsLeavesOutBankAccounts(t *testing.T) {
+	b := testBank(t)
+	b.CountryCode, b.Code = "CA", "TST"
+	tests := []struct {
+		name    string
+		account uuid.UUID
+		sum     int
+		counted bool
+	}{
+		{"customer", uuid.New(), 300, true},
+		{"another customer", uuid.New(), 200, true},
+		{"house", b.House().AccountID, 1000, false},
+		{"central bank", b.SettlementAccount("central-bank").AccountID, 5000, false},
+		{"treasury", b.SettlementAccount("treasury").AccountID, 7000, false},
+	}
+	expected := 0
+	for _, tt := range tests {
+		if err := b.deposit(tt.account, "USD", tt.sum); err != nil {
+			t.Fatalf("%s: %s", tt.name, err)
+		}
+		if tt.counted {
+			expected += tt.sum
+		}
+	}
+	if err := b.hold(tests[0].account, "USD", 100); err != nil {
+		t.Fatal(err)
+	}
+	got, err := b.TotalDeposits("USD")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != expected {
+		t.Errorf("expected %d, got %d", expected, got)
+	}
+	reserves, err := b.Reserves("USD")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reserves != 1000 {
+		t.Errorf("expected reserves of 1000, got %d", reserves)
+	}
+}
+
+func TestAdminTransfer(t *testing.T) {
+	b := testBank(t)
+	from, to := uuid.New(), uuid.New()
+	if err := b.deposit(from, "USD", 1000); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name     string
+		transfer Transfer
+		status   string
+		from     int
+		to       int
+	}{
+		{"moved", Transfer{From: from, To: to, Currency: "USD", Unit: Minor, Sum: 400}, "OK", 600, 400},
+		{"in major units", Transfer{From: from, To: to, Currency: "USD", Unit: Major, Sum: 2}, "OK", 400, 600},
+		{"insufficient funds", Transfer{From: from, To: to, Currency: "USD", Unit: Minor, Sum: 5000}, "Error", 400, 600},
+		{"to itself", Transfer{From: from, To: from, Currency: "USD", Unit: Minor, Sum: 100}, "Error", 400, 600},
+		{"no account", Transfer{From: from, Currency: "USD", Unit: Minor, Sum: 100}, "Error", 400, 600},
+		{"unknown currency", Transfer{From: from, To: to, Currency: "XXX", Unit: Minor, Sum: 100}, "Error", 400, 600},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := &fakeRequest{}
+			b.AdminTransfer(req, tt.transfer)
+			if resp := req.status(t); resp.Status != tt.status {
+				t.Errorf("expected %s, got %+v", tt.status, resp)
+			}
+			for id, expected := range map[uuid.UUID]int{from: tt.from, to: tt.to} {
+				got, err := b.get(id, "USD", Available)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if got != expected {
+					t.Errorf("expected %d in %s, got %d", expected, id, got)
+				}
+			}
+		})
+	}
+}
+
+func TestPaymentsAppliedOnce(t *testing.T) {
+	b := testBank(t)
+	from, to := uuid.New(), uuid.New()
+	if err := b.deposit(from, "USD", 1000); err != nil {
+		t.Fatal(err)
+	}
+	deposit := Deposit{AccountID: to, Currency: "USD", Unit: Minor, Sum: 100, Reference: uuid.New()}
+	withdrawal := Withdrawal{AccountID: from, Currency: "USD", Unit: Minor, Sum: 100, Reference: uuid.New()}
+	transfer := Transfer{From: from, To: to, Currency: "USD", Unit: Minor, Sum: 100, Reference: uuid.New()}
+	for i := 0; i < 3; i++ {
+		b.AdminDeposit(&fakeRequest{}, deposit)
+		b.AdminWithdraw(&fakeRequest{}, withdrawal)
+		b.AdminTransfer(&fakeRequest{}, transfer)
+	}
+	for id, expected := range map[uuid.UUID]int{from: 800, to: 200} {
+		got, err := b.get(id, "USD", Available)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != expected {
+			t.Errorf("expected %d in %s, got %d", expected, id, got)
+		}
+	}
+
+	failed := Transfer{From: from, To: to, Currency: "USD", Unit: Minor, Sum: 5000, Reference: uuid.New()}
+	b.AdminTransfer(&fakeRequest{}, failed)
+	if err := b.deposit(from, "USD", 5000); err != nil {
+		t.Fatal(err)
+	}
+	req := &fakeRequest{}
+	b.AdminTransfer(req, failed)
+	if resp := req.status(t); resp.Status != "OK" {
+		t.Errorf("expected a failed payment to be sent again, got %+v", resp)
+	}
+
+	pending := uuid.New()
+	if _, err := b.payments.Create(pending.String(), []byte(paymentPending)); err != nil {
+		t.Fatal(err)
+	}
+	req = &fakeRequest{}
+	b.AdminDeposit(req, Deposit{AccountID: to, Currency: "USD", Unit: Minor, Sum: 100, Reference: pending})
+	if resp := req.status(t); resp.Status != "Pending" {
+		t.Errorf("expected a payment in progress to be pending, got %+v", resp)
+	}
+}
+
+// unrecorded is a payments bucket that cannot mark payments applied.
+type unrecorded struct {
+	nats.KeyValue
+}
+
+func (unrecorded) Put(string, []byte) (uint64, error) {
+	return 0, nats.ErrConnectionClosed
+}
+
+func TestPaymentAppliedButNotRecorded(t *testing.T) {
+	b := testBank(t)
+	b.payments = unrecorded{b.payments}
+	from, to := uuid.New(), uuid.New()
+	if err := b.deposit(from, "USD", 1000); err != nil {
+		t.Fatal(err)
+	}
+	req := &fakeRequest{}
+	b.AdminTransfer(req, Transfer{From: from, To: to, Currency: "USD", Unit: Minor, Sum: 100, Reference: uuid.New()})
+	if resp := req.status(t); resp.Status != "Applied" {
+		t.Errorf("expected the payment to be reported applied, got %+v", resp)
+	}
+	got, err := b.get(to, "USD", Available)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != 100 {
+		t.Errorf("expected 100 in %s, got %d", to, got)
+	}
+}
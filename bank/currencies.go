@@ -36,6 +36,11 @@ func (v CurrencyValue) CalcUpdate() int {
 	return delta + shift
 }
 
+// Convert returns the value expressed in the given unit.
+func (v CurrencyValue) Convert(to UnitType) (int, error) {
+	return Convert(v.Currency, v.Unit, to, v.Value)
+}
+
 type UnitType string
 
 const (
@@ -290,6 +295,14 @@ func initCurrencies() ([]Currency, error) {
 	}, nil
 }
 
+// Convert converts sum between two units of a currency without needing a
+// connected Bank.
+func Convert(code CurrencyCode, from, to UnitType, sum int) (int, error) {
+	b := Bank{}
+	b.Setup()
+	return b.ConvertCurrency(code, from, to, sum)
+}
+
 func (b Bank) ConvertCurrency(code CurrencyCode, from, to UnitType, sum int) (int, error) {
 	currency, ok := b.currencyMap[code]
 	if !ok {
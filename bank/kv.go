@@ -2,24 +2,167 @@ package bank
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
+	"log"
+	"time"
 
 	"github.com/google/uuid"
+	"github.com/nats-io/nats.go"
 )
 
-func (b Bank) put(id uuid.UUID, currency CurrencyCode, status Availability, value int) error {
+// casRetries is how many times a balance update is tried again after losing
+// a race with another writer before giving up.
+const casRetries = 100
+
+func (b Bank) key(id uuid.UUID, currency CurrencyCode, status Availability) (string, error) {
+	if _, ok := b.currencyMap[currency]; !ok {
+		return "", fmt.Errorf("err: unknown currency: %s", currency)
+	}
+	return fmt.Sprintf("%s.%s.%s", id.String(), string(currency), string(status)), nil
+}
+
+// create sets a balance that does not exist yet. It leaves one that does.
+func (b Bank) create(id uuid.UUID, currency CurrencyCode, status Availability, value int) error {
+	key, err := b.key(id, currency, status)
+	if err != nil {
+		return err
+	}
 	v, err := json.Marshal(value)
 	if err != nil {
 		return err
 	}
-	if _, ok := b.currencyMap[currency]; !ok {
-		return fmt.Errorf("err: unknown currency: %s", currency)
+	_, err = b.accounts.Create(key, v)
+	if errors.Is(err, nats.ErrKeyExists) {
+		return nil
 	}
-	key := fmt.Sprintf("%s.%s.%s", id.String(), string(currency), string(status))
-	_, err = b.accounts.Put(key, v)
 	return err
 }
 
+// update changes a balance to what fn makes of it. The new balance is only
+// written if nobody else wrote one since it was read, otherwise fn is applied
+// again to the newer balance. A missing balance starts from zero if create is
+// set.
+func (b Bank) update(id uuid.UUID, currency CurrencyCode, status Availability, create bool, fn func(int) (int, error)) error {
+	key, err := b.key(id, currency, status)
+	if err != nil {
+		return err
+	}
+	for i := 0; i < casRetries; i++ {
+		current, revision := 0, uint64(0)
+		entry, err := b.accounts.Get(key)
+		switch {
+		case errors.Is(err, nats.ErrKeyNotFound) && create:
+		case err != nil:
+			return err
+		default:
+			if err := json.Unmarshal(entry.Value(), &current); err != nil {
+				return err
+			}
+			revision = entry.Revision()
+		}
+		next, err := fn(current)
+		if err != nil {
+			return err
+		}
+		v, err := json.Marshal(next)
+		if err != nil {
+			return err
+		}
+		if revision == 0 {
+			_, err = b.accounts.Create(key, v)
+		} else {
+			_, err = b.accounts.Update(key, v, revision)
+		}
+		if err == nil {
+			return nil
+		}
+		if !isConflict(err) {
+			return err
+		}
+	}
+	return fmt.Errorf("err: %s kept changing, gave up after %d tries", key, casRetries)
+}
+
+// isConflict reports whether a write lost to another writer.
+func isConflict(err error) bool {
+	var apiErr *nats.APIError
+	return errors.Is(err, nats.ErrKeyExists) ||
+		(errors.As(err, &apiErr) && apiErr.ErrorCode == nats.JSErrCodeStreamWrongLastSequence)
+}
+
+// The payments bucket makes deposits, withdrawals and transfers safe to send
+// again. A payment's reference is claimed as pending before the money moves
+// and marked applied after, so a payment that went through is not applied a
+// second time. References are forgotten after paymentTTL.
+const (
+	paymentPending = "pending"
+	paymentApplied = "applied"
+	paymentTTL     = 24 * time.Hour
+)
+
+// recordRetries is how many times a payment is marked applied before giving
+// up on the payments bucket.
+const recordRetries = 3
+
+var (
+	// errInProgress means a payment with the same reference is being
+	// applied.
+	errInProgress = errors.New("payment in progress")
+	// errUnrecorded means a payment was applied but could not be marked so.
+	// Sent again, it would be taken for one still in progress.
+	errUnrecorded = errors.New("payment applied but not recorded")
+)
+
+// once applies a payment unless its reference was applied before. Payments
+// without a reference are always applied.
+func (b Bank) once(ref uuid.UUID, apply func() error) error {
+	_, err := b.record(ref, func() ([]byte, error) {
+		return []byte(paymentApplied), apply()
+	})
+	return err
+}
+
+// record is once for requests that must be answered the same every time
+// they are sent: what the first one was answered is kept as the record of
+// it and handed back to any sent again.
+func (b Bank) record(ref uuid.UUID, apply func() ([]byte, error)) ([]byte, error) {
+	if ref == uuid.Nil {
+		return apply()
+	}
+	key := ref.String()
+	if _, err := b.payments.Create(key, []byte(paymentPending)); err != nil {
+		if !errors.Is(err, nats.ErrKeyExists) {
+			return nil, err
+		}
+		entry, err := b.payments.Get(key)
+		if err != nil {
+			return nil, err
+		}
+		if string(entry.Value()) != paymentPending {
+			return entry.Value(), nil
+		}
+		return nil, fmt.Errorf("err: %s: %w", ref, errInProgress)
+	}
+	answer, err := apply()
+	if err != nil {
+		if err := b.payments.Delete(key); err != nil {
+			log.Println(err)
+		}
+		return nil, err
+	}
+	for i := 1; ; i++ {
+		_, err := b.payments.Put(key, answer)
+		if err == nil {
+			return answer, nil
+		}
+		if i == recordRetries {
+			return answer, fmt.Errorf("err: %s: %w: %s", ref, errUnrecorded, err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
 func (b Bank) get(id uuid.UUID, currency CurrencyCode, status Availability) (int, error) {
 	key := fmt.Sprintf("%s.%s.%s", id.String(), string(currency), string(status))
 	v, err := b.accounts.Get(key)
@@ -31,22 +174,54 @@ func (b Bank) get(id uuid.UUID, currency CurrencyCode, status Availability) (int
 	return i, err
 }
 
+// The customers bucket indexes accounts by owner, keyed by owner and account
+// with the account's status.
 func (b Bank) addCustomerAccount(id uuid.UUID, accountID uuid.UUID) error {
+	return b.putCustomerAccount(id, accountID, Active)
+}
+
+func (b Bank) cancelCustomerAccount(id uuid.UUID, accountID uuid.UUID) error {
+	return b.putCustomerAccount(id, accountID, Cancelled)
+}
+
+func (b Bank) putCustomerAccount(id uuid.UUID, accountID uuid.UUID, status AccountStatus) error {
 	key := fmt.Sprintf("%s.%s", id.String(), accountID.String())
-	v, err := json.Marshal(Active)
+	v, err := json.Marshal(status)
 	if err != nil {
 		return err
 	}
-	_, err = b.accounts.Put(key, v)
+	_, err = b.customers.Put(key, v)
 	return err
 }
 
-func (b Bank) cancelCustomerAccount(id uuid.UUID, accountID uuid.UUID) error {
+func (b Bank) customerAccountStatus(id uuid.UUID, accountID uuid.UUID) (AccountStatus, error) {
 	key := fmt.Sprintf("%s.%s", id.String(), accountID.String())
-	v, err := json.Marshal(Cancelled)
+	v, err := b.customers.Get(key)
 	if err != nil {
-		return err
+		return "", err
 	}
-	_, err = b.accounts.Put(key, v)
-	return err
+	var status AccountStatus
+	err = json.Unmarshal(v.Value(), &status)
+	return status, err
+}
+
+// customerKeys lists the keys in the customers bucket matching filter.
+func (b Bank) customerKeys(filter string) ([]string, error) {
+	w, err := b.customers.Watch(filter, nats.IgnoreDeletes(), nats.MetaOnly())
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := w.Stop(); err != nil {
+			log.Println(err)
+		}
+	}()
+	keys := []string{}
+	for entry := range w.Updates() {
+		if entry == nil {
+			break
+		}
+		keys = append(keys, entry.Key())
+	}
+	return keys, nil
 }
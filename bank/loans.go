@@ -0,0 +1,364 @@
+package bank
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+
+	"github.com/google/uuid"
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/micro"
+)
+
+const daysPerYear = 360
+
+// Lending sets how the bank underwrites loans. Rates are the policy rate plus
+// Spread plus the RatingSpreads for the applicant's credit rating, in basis
+// points a year. An applicant's debt after the loan may be
+// at most MaxDebtToEquity basis points of its equity, and its annual earnings
+// must cover annual interest MinInterestCoverage hundredths of times over.
+// Loans are repaid every PaymentDays and run for TermDays.
+type Lending struct {
+	Spread              int            `yaml:"spread"`
+	RatingSpreads       map[string]int `yaml:"rating_spreads"`
+	MaxDebtToEquity     int            `yaml:"max_debt_to_equity"`
+	MinInterestCoverage int            `yaml:"min_interest_coverage"`
+	PaymentDays         int            `yaml:"payment_days"`
+	TermDays            int            `yaml:"term_days"`
+}
+
+// Financials are what an applicant declares about itself, in minor units.
+// Earnings and Interest are quarterly.
+type Financials struct {
+	Assets      int
+	Liabilities int
+	Equity      int
+	Earnings    int
+	Interest    int
+}
+
+type LoanApplication struct {
+	Reference  uuid.UUID
+	Borrower   uuid.UUID
+	Currency   CurrencyCode
+	Principal  int
+	Day        int
+	Rating     string
+	Financials Financials
+}
+
+// Loan is an amortizing loan in minor units. Interest accrues daily on the
+// outstanding principal and every Payment covers the interest accrued since
+// the last one with the rest going to principal.
+type Loan struct {
+	ID          uuid.UUID
+	Borrower    uuid.UUID
+	Currency    CurrencyCode
+	Principal   int
+	Outstanding int
+	Rate        int
+	PaymentDays int
+	Payment     int
+	NextPayment int
+	Maturity    int
+	Accrued     int
+	AccruedTo   int
+}
+
+type Repayment struct {
+	Reference uuid.UUID
+	LoanID    uuid.UUID
+	Day       int
+}
+
+// LoanSettlement closes a loan for whatever of Sum the borrower can pay. The
+// rest is written off.
+type LoanSettlement struct {
+	Reference uuid.UUID
+	LoanID    uuid.UUID
+	Day       int
+	Sum       int
+}
+
+type LoanResponse struct {
+	Status     string
+	Message    string
+	Loan       Loan
+	Interest   int
+	Principal  int
+	WrittenOff int
+}
+
+// SetPolicyRate tells the bank the central bank's current rate.
+func (b *Bank) SetPolicyRate(rate int) {
+	b.policyRate.Store(int64(rate))
+}
+
+func (b *Bank) rate(rating string) int {
+	spread := b.Lending.Spread + b.Lending.RatingSpreads[rating]
+	if b.policyRate == nil {
+		return spread
+	}
+	return int(b.policyRate.Load()) + spread
+}
+
+// DailyInterest is a day's interest on the loan's outstanding principal.
+func (l Loan) DailyInterest() int {
+	return l.Outstanding * l.Rate / 10000 / daysPerYear
+}
+
+func (l *Loan) accrue(day int) {
+	if day > l.AccruedTo {
+		l.Accrued += l.DailyInterest() * (day - l.AccruedTo)
+		l.AccruedTo = day
+	}
+}
+
+// underwrite checks the applicant could carry the loan at the given rate.
+func (b *Bank) underwrite(a LoanApplication, rate int) error {
+	f := a.Financials
+	if a.Principal <= 0 {
+		return fmt.Errorf("loan rejected: principal must be positive")
+	}
+	if f.Equity <= 0 {
+		return fmt.Errorf("loan rejected: negative equity")
+	}
+	debt := float64(f.Liabilities+a.Principal) * 10000 / float64(f.Equity)
+	if debt > float64(b.Lending.MaxDebtToEquity) {
+		return fmt.Errorf("loan rejected: debt to equity %.0f above %d", debt, b.Lending.MaxDebtToEquity)
+	}
+	interest := 4*float64(f.Interest) + float64(a.Principal)*float64(rate)/10000
+	if interest > 0 {
+		coverage := 4 * float64(f.Earnings) * 100 / interest
+		if coverage < float64(b.Lending.MinInterestCoverage) {
+			return fmt.Errorf("loan rejected: interest coverage %.0f below %d", coverage, b.Lending.MinInterestCoverage)
+		}
+	}
+	return nil
+}
+
+// payment is the level installment that repays principal over the term.
+func (b *Bank) payment(principal, rate int) int {
+	n := float64(b.Lending.TermDays / b.Lending.PaymentDays)
+	i := float64(rate) / 10000 * float64(b.Lending.PaymentDays) / daysPerYear
+	if i == 0 {
+		return int(math.Ceil(float64(principal) / n))
+	}
+	return int(math.Ceil(float64(principal) * i / (1 - math.Pow(1+i, -n))))
+}
+
+// AdminLoan underwrites a loan and pays the principal out of the bank's own
+// account. The loan is written down before the principal is paid out and
+// struck off again if the payout fails, so no money leaves the bank without
+// a loan on the books.
+func (b *Bank) AdminLoan(req micro.Request, a LoanApplication) {
+	resp, err := b.loanOnce(a.Reference, func() (LoanResponse, error) {
+		return b.lend(a)
+	})
+	respondLoan(req, resp, err)
+}
+
+func (b *Bank) lend(a LoanApplication) (LoanResponse, error) {
+	if b.Lending.PaymentDays <= 0 || b.Lending.TermDays < b.Lending.PaymentDays {
+		return LoanResponse{}, fmt.Errorf("bank does not lend")
+	}
+	rate := b.rate(a.Rating)
+	if err := b.underwrite(a, rate); err != nil {
+		return LoanResponse{}, err
+	}
+	loan := Loan{
+		ID:          uuid.New(),
+		Borrower:    a.Borrower,
+		Currency:    a.Currency,
+		Principal:   a.Principal,
+		Outstanding: a.Principal,
+		Rate:        rate,
+		PaymentDays: b.Lending.PaymentDays,
+		Payment:     b.payment(a.Principal, rate),
+		NextPayment: a.Day + b.Lending.PaymentDays,
+		Maturity:    a.Day + b.Lending.TermDays,
+		AccruedTo:   a.Day,
+	}
+	v, err := json.Marshal(loan)
+	if err != nil {
+		return LoanResponse{}, err
+	}
+	if _, err := b.loans.Create(loan.ID.String(), v); err != nil {
+		return LoanResponse{}, err
+	}
+	if err := b.transfer(b.House().AccountID, a.Borrower, a.Currency, a.Principal, false); err != nil {
+		if err := b.loans.Delete(loan.ID.String()); err != nil {
+			log.Println(err)
+		}
+		return LoanResponse{}, fmt.Errorf("loan rejected: %s", err)
+	}
+	return LoanResponse{Status: "OK", Loan: loan}, nil
+}
+
+// AdminRepay collects the installment due on the given day from the
+// borrower's account into the bank's own.
+func (b *Bank) AdminRepay(req micro.Request, r Repayment) {
+	resp, err := b.loanOnce(r.Reference, func() (LoanResponse, error) {
+		return b.repay(r)
+	})
+	respondLoan(req, resp, err)
+}
+
+// repay takes the installment off the loan before collecting it, and puts it
+// back if the borrower cannot pay.
+func (b *Bank) repay(r Repayment) (LoanResponse, error) {
+	var interest, principal int
+	loan, revision, err := b.updateLoan(r.LoanID, func(l *Loan) {
+		l.accrue(r.Day)
+		due := min(l.Payment, l.Accrued+l.Outstanding)
+		if r.Day >= l.Maturity {
+			due = l.Accrued + l.Outstanding
+		}
+		interest = min(due, l.Accrued)
+		principal = due - interest
+		l.Accrued -= interest
+		l.Outstanding -= principal
+		l.NextPayment += l.PaymentDays
+	})
+	if err != nil {
+		return LoanResponse{}, err
+	}
+	if err := b.transfer(loan.Borrower, b.House().AccountID, loan.Currency, interest+principal, false); err != nil {
+		_, _, undo := b.updateLoan(r.LoanID, func(l *Loan) {
+			l.Accrued += interest
+			l.Outstanding += principal
+			l.NextPayment -= l.PaymentDays
+		})
+		if undo != nil {
+			log.Println(undo)
+		}
+		return LoanResponse{}, err
+	}
+	if loan.Outstanding <= 0 {
+		b.strikeOff(loan, revision)
+	}
+	return LoanResponse{Status: "OK", Loan: loan, Interest: interest, Principal: principal}, nil
+}
+
+// AdminSettle collects up to Sum of what is owed on a loan, interest first,
+// and writes off the rest.
+func (b *Bank) AdminSettle(req micro.Request, s LoanSettlement) {
+	resp, err := b.loanOnce(s.Reference, func() (LoanResponse, error) {
+		return b.settle(s)
+	})
+	respondLoan(req, resp, err)
+}
+
+// settle clears the loan before collecting what is paid, and puts it back
+// if the borrower cannot pay.
+func (b *Bank) settle(s LoanSettlement) (LoanResponse, error) {
+	owed := Loan{}
+	_, revision, err := b.updateLoan(s.LoanID, func(l *Loan) {
+		l.accrue(s.Day)
+		owed = *l
+		l.Accrued, l.Outstanding = 0, 0
+	})
+	if err != nil {
+		return LoanResponse{}, err
+	}
+	paid := max(0, min(s.Sum, owed.Accrued+owed.Outstanding))
+	if paid > 0 {
+		if err := b.transfer(owed.Borrower, b.House().AccountID, owed.Currency, paid, false); err != nil {
+			_, _, undo := b.updateLoan(s.LoanID, func(l *Loan) {
+				l.Accrued, l.Outstanding = owed.Accrued, owed.Outstanding
+			})
+			if undo != nil {
+				log.Println(undo)
+			}
+			return LoanResponse{}, err
+		}
+	}
+	b.strikeOff(owed, revision)
+	interest := min(paid, owed.Accrued)
+	return LoanResponse{
+		Status:     "OK",
+		Loan:       owed,
+		Interest:   interest,
+		Principal:  paid - interest,
+		WrittenOff: owed.Accrued + owed.Outstanding - paid,
+	}, nil
+}
+
+// loanOnce applies a loan request once per reference, and answers one that
+// is sent again with what the first was answered.
+func (b Bank) loanOnce(ref uuid.UUID, apply func() (LoanResponse, error)) (LoanResponse, error) {
+	resp := LoanResponse{}
+	v, err := b.record(ref, func() ([]byte, error) {
+		resp, err := apply()
+		if err != nil {
+			return nil, err
+		}
+		return json.Marshal(resp)
+	})
+	if v != nil {
+		if err := json.Unmarshal(v, &resp); err != nil {
+			return resp, err
+		}
+	}
+	return resp, err
+}
+
+// respondLoan answers a loan request. One that was applied but not recorded
+// is answered in full with the status Applied.
+func respondLoan(req micro.Request, resp LoanResponse, err error) {
+	if errors.Is(err, errUnrecorded) {
+		log.Println(err)
+		resp.Status, resp.Message = "Applied", err.Error()
+	} else if err != nil {
+		respondPaymentError(req, err)
+		return
+	}
+	if err := req.RespondJSON(resp); err != nil {
+		log.Println(err)
+	}
+}
+
+// updateLoan changes a loan to what fn makes of it, like update does a
+// balance: it is only written if nobody else wrote it since it was read,
+// otherwise fn is applied again to the newer loan. It returns the loan as
+// written and its revision.
+func (b Bank) updateLoan(id uuid.UUID, fn func(*Loan)) (Loan, uint64, error) {
+	key := id.String()
+	for i := 0; i < casRetries; i++ {
+		l := Loan{}
+		entry, err := b.loans.Get(key)
+		if err != nil {
+			return l, 0, err
+		}
+		if err := json.Unmarshal(entry.Value(), &l); err != nil {
+			return l, 0, err
+		}
+		fn(&l)
+		v, err := json.Marshal(l)
+		if err != nil {
+			return l, 0, err
+		}
+		revision, err := b.loans.Update(key, v, entry.Revision())
+		if err == nil {
+			return l, revision, nil
+		}
+		if !isConflict(err) {
+			return l, 0, err
+		}
+	}
+	return Loan{}, 0, fmt.Errorf("err: loan %s kept changing, gave up after %d tries", id, casRetries)
+}
+
+// strikeOff deletes a loan that is paid off or settled, unless it changed
+// since.
+func (b Bank) strikeOff(l Loan, revision uint64) {
+	if err := b.loans.Delete(l.ID.String(), nats.LastRevision(revision)); err != nil {
+		log.Println(err)
+	}
+}
+
+func (b Bank) loanBucket() string {
+	return fmt.Sprintf("bank-loans-%s-%s-%d", b.CountryCode, b.Code, b.ID)
+}
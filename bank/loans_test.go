@@ -0,0 +1,221 @@
+package bank
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestPayment(t *testing.T) {
+	b := &Bank{Lending: Lending{PaymentDays: 90, TermDays: 360}}
+	tests := []struct {
+		name      string
+		principal int
+		rate      int
+		expected  int
+	}{
+		{"interest free", 1000, 0, 250},
+		{"interest free rounded up", 1001, 0, 251},
+		{"ten percent", 1000, 1000, 266},
+		{"large loan", 100000000, 500, 25786103},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := b.payment(tt.principal, tt.rate); got != tt.expected {
+				t.Errorf("expected %d, got %d", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestPaymentsRepayPrincipal(t *testing.T) {
+	b := &Bank{Lending: Lending{PaymentDays: 30, TermDays: 720}}
+	principal, rate := 5000000, 800
+	payment := b.payment(principal, rate)
+	l := Loan{Outstanding: principal, Rate: rate}
+	for i := 0; i < b.Lending.TermDays/b.Lending.PaymentDays; i++ {
+		l.accrue(l.AccruedTo + b.Lending.PaymentDays)
+		l.Outstanding -= payment - l.Accrued
+		l.Accrued = 0
+	}
+	if l.Outstanding > 0 {
+		t.Errorf("expected the loan to be repaid, %d outstanding", l.Outstanding)
+	}
+}
+
+func TestUnderwrite(t *testing.T) {
+	b := &Bank{Lending: Lending{MaxDebtToEquity: 20000, MinInterestCoverage: 300}}
+	tests := []struct {
+		name       string
+		principal  int
+		financials Financials
+		rate       int
+		approved   bool
+	}{
+		{
+			name:       "sound",
+			principal:  1000,
+			financials: Financials{Assets: 3000, Liabilities: 1000, Equity: 2000, Earnings: 500},
+			rate:       1000,
+			approved:   true,
+		},
+		{
+			name:       "no principal",
+			principal:  0,
+			financials: Financials{Assets: 3000, Liabilities: 1000, Equity: 2000, Earnings: 500},
+			rate:       1000,
+			approved:   false,
+		},
+		{
+			name:       "negative equity",
+			principal:  1000,
+			financials: Financials{Assets: 1000, Liabilities: 2000, Equity: -1000, Earnings: 500},
+			rate:       1000,
+			approved:   false,
+		},
+		{
+			name:       "too leveraged",
+			principal:  4000,
+			financials: Financials{Assets: 3000, Liabilities: 1000, Equity: 2000, Earnings: 5000},
+			rate:       1000,
+			approved:   false,
+		},
+		{
+			name:       "interest not covered",
+			principal:  1000,
+			financials: Financials{Assets: 3000, Liabilities: 1000, Equity: 2000, Earnings: 50, Interest: 10},
+			rate:       1000,
+			approved:   false,
+		},
+		{
+			name:       "interest free",
+			principal:  1000,
+			financials: Financials{Assets: 3000, Liabilities: 1000, Equity: 2000},
+			rate:       0,
+			approved:   true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := LoanApplication{Principal: tt.principal, Financials: tt.financials}
+			if err := b.underwrite(a, tt.rate); (err == nil) != tt.approved {
+				t.Errorf("expected approved %t, got %v", tt.approved, err)
+			}
+		})
+	}
+}
+
+func TestAdminLoan(t *testing.T) {
+	tests := []struct {
+		name      string
+		principal int
+		status    string
+		house     int
+		borrower  int
+		loans     int
+	}{
+		{"paid out", 600, "OK", 400, 600, 1},
+		{"more than the bank has", 5000, "Error", 1000, 0, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := testBank(t)
+			b.Lending = Lending{PaymentDays: 30, TermDays: 360, MaxDebtToEquity: 20000}
+			house := b.House().AccountID
+			if err := b.deposit(house, "USD", 1000); err != nil {
+				t.Fatal(err)
+			}
+			borrower := uuid.New()
+			req := &fakeRequest{}
+			b.AdminLoan(req, LoanApplication{
+				Borrower:   borrower,
+				Currency:   "USD",
+				Principal:  tt.principal,
+				Financials: Financials{Assets: 100000, Equity: 100000},
+			})
+			if resp := req.status(t); resp.Status != tt.status {
+				t.Errorf("expected %s, got %+v", tt.status, resp)
+			}
+			for id, expected := range map[uuid.UUID]int{house: tt.house, borrower: tt.borrower} {
+				account, err := b.getAccount(id)
+				if err != nil && expected != 0 {
+					t.Fatal(err)
+				}
+				if got := account.Funds["USD"].AvailableMinor; got != expected {
+					t.Errorf("expected %d in %s, got %d", expected, id, got)
+				}
+			}
+			keys, _ := b.loans.Keys()
+			if len(keys) != tt.loans {
+				t.Errorf("expected %d loans on the books, got %d", tt.loans, len(keys))
+			}
+		})
+	}
+}
+
+func TestAdminRepay(t *testing.T) {
+	tests := []struct {
+		name        string
+		sends       int
+		spent       int
+		status      string
+		borrower    int
+		outstanding int
+	}{
+		{"repaid", 1, 0, "OK", 550, 550},
+		{"sent again", 2, 0, "OK", 550, 550},
+		{"cannot pay", 1, 600, "Error", 0, 600},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := testBank(t)
+			b.Lending = Lending{PaymentDays: 30, TermDays: 360, MaxDebtToEquity: 20000}
+			if err := b.deposit(b.House().AccountID, "USD", 1000); err != nil {
+				t.Fatal(err)
+			}
+			borrower := uuid.New()
+			req := &fakeRequest{}
+			b.AdminLoan(req, LoanApplication{
+				Reference:  uuid.New(),
+				Borrower:   borrower,
+				Currency:   "USD",
+				Principal:  600,
+				Financials: Financials{Assets: 100000, Equity: 100000},
+			})
+			loan := LoanResponse{}
+			if err := json.Unmarshal(req.response, &loan); err != nil {
+				t.Fatal(err)
+			}
+			if err := b.withdraw(borrower, "USD", tt.spent); tt.spent > 0 && err != nil {
+				t.Fatal(err)
+			}
+			repayment := Repayment{Reference: uuid.New(), LoanID: loan.Loan.ID, Day: 30}
+			for i := 0; i < tt.sends; i++ {
+				req = &fakeRequest{}
+				b.AdminRepay(req, repayment)
+				if resp := req.status(t); resp.Status != tt.status {
+					t.Errorf("expected %s, got %+v", tt.status, resp)
+				}
+			}
+			account, err := b.getAccount(borrower)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := account.Funds["USD"].AvailableMinor; got != tt.borrower {
+				t.Errorf("expected the borrower to have %d, got %d", tt.borrower, got)
+			}
+			entry, err := b.loans.Get(loan.Loan.ID.String())
+			if err != nil {
+				t.Fatal(err)
+			}
+			l := Loan{}
+			if err := json.Unmarshal(entry.Value(), &l); err != nil {
+				t.Fatal(err)
+			}
+			if l.Outstanding != tt.outstanding {
+				t.Errorf("expected %d outstanding, got %d", tt.outstanding, l.Outstanding)
+			}
+		})
+	}
+}
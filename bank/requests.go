@@ -5,3 +5,22 @@ import "github.com/google/uuid"
 type NewAccountPayload struct {
 	UserID uuid.UUID `json:"user_id"`
 }
+
+type AccountRequest struct {
+	AccountID uuid.UUID `json:"account_id"`
+}
+
+type AccountsRequest struct {
+	UserID uuid.UUID `json:"user_id"`
+}
+
+// AccountRef locates an account across every bank in the world.
+type AccountRef struct {
+	CountryCode string    `json:"country_code"`
+	BankCode    string    `json:"bank_code"`
+	AccountID   uuid.UUID `json:"account_id"`
+}
+
+func (a AccountRef) SameBank(o AccountRef) bool {
+	return a.CountryCode == o.CountryCode && a.BankCode == o.BankCode
+}
@@ -5,6 +5,11 @@ type AccountResponse struct {
 	Account Account `json:"account"`
 }
 
+type AccountsResponse struct {
+	Status   string    `json:"status"`
+	Accounts []Account `json:"accounts"`
+}
+
 type Response struct {
 	Status  string `json:"status"`
 	Message string `json:"message,omitempty"`
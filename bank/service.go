@@ -2,9 +2,9 @@ package bank
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
-	"strings"
 
 	"github.com/google/uuid"
 	"github.com/nats-io/nats.go"
@@ -16,12 +16,16 @@ import (
 ///////////////////////////////////////////////////////////////////////////////
 
 type Handler interface {
-	CreateAccount(micro.Request, uuid.UUID)
-	GetAccountByID(micro.Request, uuid.UUID)
-	GetAccountsByOwnerID(micro.Request, uuid.UUID)
+	CreateAccount(micro.Request, NewAccountPayload)
+	GetAccountByID(micro.Request, AccountRequest)
+	GetAccountsByOwnerID(micro.Request, AccountsRequest)
 	AdminDeposit(micro.Request, Deposit)
 	AdminTransfer(micro.Request, Transfer)
+	AdminWithdraw(micro.Request, Withdrawal)
 	AdminHold(micro.Request, Hold)
+	AdminLoan(micro.Request, LoanApplication)
+	AdminRepay(micro.Request, Repayment)
+	AdminSettle(micro.Request, LoanSettlement)
 }
 
 type ServiceWrapper struct {
@@ -69,37 +73,112 @@ func CreateService(nc *nats.Conn, h Handler, opts Options) (micro.Service, error
 	if err := admin.AddEndpoint("transfer", micro.HandlerFunc(s.AdminTransfer)); err != nil {
 		return nil, err
 	}
+	if err := admin.AddEndpoint("withdraw", micro.HandlerFunc(s.AdminWithdraw)); err != nil {
+		return nil, err
+	}
 	if err := admin.AddEndpoint("hold", micro.HandlerFunc(s.AdminHold)); err != nil {
 		return nil, err
 	}
+	if err := admin.AddEndpoint("loan", micro.HandlerFunc(s.AdminLoan)); err != nil {
+		return nil, err
+	}
+	if err := admin.AddEndpoint("repay", micro.HandlerFunc(s.AdminRepay)); err != nil {
+		return nil, err
+	}
+	if err := admin.AddEndpoint("settle", micro.HandlerFunc(s.AdminSettle)); err != nil {
+		return nil, err
+	}
 	return service, nil
 }
 
-func (s *ServiceWrapper) CreateAccount(r micro.Request) {
+func (s *ServiceWrapper) CreateAccount(req micro.Request) {
+	r := NewAccountPayload{}
+	if err := json.Unmarshal(req.Data(), &r); err != nil {
+		respondError(req, "cannot parse request")
+		return
+	}
+	s.Handler.CreateAccount(req, r)
 }
 
-func (s *ServiceWrapper) GetAccountByID(r micro.Request) {
+func (s *ServiceWrapper) GetAccountByID(req micro.Request) {
+	r := AccountRequest{}
+	if err := json.Unmarshal(req.Data(), &r); err != nil {
+		respondError(req, "cannot parse request")
+		return
+	}
+	s.Handler.GetAccountByID(req, r)
 }
 
-func (s *ServiceWrapper) GetAccountsByOwnerID(r micro.Request) {
+func (s *ServiceWrapper) GetAccountsByOwnerID(req micro.Request) {
+	r := AccountsRequest{}
+	if err := json.Unmarshal(req.Data(), &r); err != nil {
+		respondError(req, "cannot parse request")
+		return
+	}
+	s.Handler.GetAccountsByOwnerID(req, r)
 }
 
 func (s ServiceWrapper) AdminDeposit(req micro.Request) {
-	subj := strings.Split(req.Subject(), ".")
-	if len(subj) != 2 {
-		respondError(req, "wrong number of tokens in subject")
-	}
 	deposit := Deposit{}
 	if err := json.Unmarshal(req.Data(), &deposit); err != nil {
-		log.Println(err)
+		respondError(req, "cannot parse request")
+		return
 	}
 	s.Handler.AdminDeposit(req, deposit)
 }
 
-func (s *ServiceWrapper) AdminTransfer(r micro.Request) {
+func (s *ServiceWrapper) AdminTransfer(req micro.Request) {
+	transfer := Transfer{}
+	if err := json.Unmarshal(req.Data(), &transfer); err != nil {
+		respondError(req, "cannot parse request")
+		return
+	}
+	s.Handler.AdminTransfer(req, transfer)
 }
 
-func (s *ServiceWrapper) AdminHold(r micro.Request) {
+func (s *ServiceWrapper) AdminWithdraw(req micro.Request) {
+	withdrawal := Withdrawal{}
+	if err := json.Unmarshal(req.Data(), &withdrawal); err != nil {
+		respondError(req, "cannot parse request")
+		return
+	}
+	s.Handler.AdminWithdraw(req, withdrawal)
+}
+
+func (s *ServiceWrapper) AdminHold(req micro.Request) {
+	hold := Hold{}
+	if err := json.Unmarshal(req.Data(), &hold); err != nil {
+		respondError(req, "cannot parse request")
+		return
+	}
+	s.Handler.AdminHold(req, hold)
+}
+
+func (s *ServiceWrapper) AdminLoan(req micro.Request) {
+	application := LoanApplication{}
+	if err := json.Unmarshal(req.Data(), &application); err != nil {
+		respondError(req, "cannot parse request")
+		return
+	}
+	s.Handler.AdminLoan(req, application)
+}
+
+func (s *ServiceWrapper) AdminRepay(req micro.Request) {
+	repayment := Repayment{}
+	if err := json.Unmarshal(req.Data(), &repayment); err != nil {
+		respondError(req, "cannot parse request")
+		return
+	}
+	s.Handler.AdminRepay(req, repayment)
+}
+
+func (s *ServiceWrapper) AdminSettle(req micro.Request) {
+	settlement := LoanSettlement{}
+	if err := json.Unmarshal(req.Data(), &settlement); err != nil {
+		respondError(req, "cannot parse request")
+		return
+	}
+	s.Handler.AdminSettle(req, settlement)
 }
 
 func (b *Bank) serviceConfig() micro.Config {
@@ -114,7 +193,13 @@ func (b *Bank) serviceConfig() micro.Config {
 ///////////////////////////////////////////////////////////////////////////////
 
 func (b *Bank) AddService(nc *nats.Conn) micro.Service {
-	srv, err := CreateService(nc, b, Options{})
+	srv, err := CreateService(nc, b, Options{
+		Name:        b.serviceName(),
+		Version:     b.version(),
+		Description: b.description(),
+		CountryCode: b.CountryCode,
+		BankCode:    b.Code,
+	})
 	if err != nil {
 		log.Fatalln(err)
 	}
@@ -131,74 +216,216 @@ func respondError(req micro.Request, errorMessage string) {
 	}
 }
 
-func (b *Bank) CreateAccount(req micro.Request, id uuid.UUID) {
-	r := NewAccountPayload{}
-	if err := json.Unmarshal(req.Data(), &r); err != nil {
-		respondError(req, "cannot parse request")
-		return
+// respondPaymentError tells the caller a payment failed, that it is still
+// being applied and is worth asking about again, or that it was applied but
+// is not safe to send again.
+func respondPaymentError(req micro.Request, err error) {
+	status := "Error"
+	switch {
+	case errors.Is(err, errInProgress):
+		status = "Pending"
+	case errors.Is(err, errUnrecorded):
+		log.Println(err)
+		status = "Applied"
 	}
-	account, err := b.newAccount(r.UserID)
+	if err := req.RespondJSON(Response{Status: status, Message: err.Error()}); err != nil {
+		log.Println(err)
+	}
+}
+
+func (b *Bank) CreateAccount(req micro.Request, r NewAccountPayload) {
+	account, err := b.openAccount(r.UserID)
 	if err != nil {
-		fmt.Println(err)
 		respondError(req, err.Error())
 		return
 	}
 	response := AccountResponse{Status: "OK", Account: account}
 	if err := req.RespondJSON(response); err != nil {
-		fmt.Println(err)
+		log.Println(err)
 	}
 }
 
-func (b Bank) GetAccountByID(req micro.Request, id uuid.UUID) {
-	_ = req.Respond([]byte("unimplemented"))
+func (b Bank) GetAccountByID(req micro.Request, r AccountRequest) {
+	account, err := b.account(r.AccountID)
+	if errors.Is(err, nats.ErrKeyNotFound) {
+		respondError(req, fmt.Sprintf("no account %s", r.AccountID))
+		return
+	}
+	if err != nil {
+		respondError(req, err.Error())
+		return
+	}
+	response := AccountResponse{Status: "OK", Account: account}
+	if err := req.RespondJSON(response); err != nil {
+		log.Println(err)
+	}
 }
 
-func (b *Bank) GetAccountsByOwnerID(req micro.Request, id uuid.UUID) {
-	_ = req.Respond([]byte("unimplemented"))
+func (b *Bank) GetAccountsByOwnerID(req micro.Request, r AccountsRequest) {
+	accounts, err := b.ownerAccounts(r.UserID)
+	if err != nil {
+		respondError(req, err.Error())
+		return
+	}
+	response := AccountsResponse{Status: "OK", Accounts: accounts}
+	if err := req.RespondJSON(response); err != nil {
+		log.Println(err)
+	}
 }
 
+// Deposit pays Sum into an account. A deposit with a Reference is applied
+// once however many times it is sent.
 type Deposit struct {
 	AccountID uuid.UUID
 	Currency  CurrencyCode
 	Unit      UnitType
 	Sum       int
+	Reference uuid.UUID
 }
 
 func (b Bank) AdminDeposit(req micro.Request, deposit Deposit) {
+	if deposit.Sum <= 0 {
+		respondError(req, "deposit failed: sum must be positive")
+		return
+	}
 	minorSum, err := b.ConvertCurrency(deposit.Currency, deposit.Unit, Minor, deposit.Sum)
 	if err != nil {
-		log.Println(err)
+		respondError(req, err.Error())
+		return
 	}
-	if err := b.put(deposit.AccountID, deposit.Currency, Available, minorSum); err != nil {
-		log.Println(err)
+	err = b.once(deposit.Reference, func() error {
+		return b.deposit(deposit.AccountID, deposit.Currency, minorSum)
+	})
+	if err != nil {
+		respondPaymentError(req, err)
+		return
 	}
 	account, err := b.getAccount(deposit.AccountID)
 	if err != nil {
-		log.Println(err)
+		respondError(req, err.Error())
+		return
 	}
 	if err := req.RespondJSON(account); err != nil {
 		log.Println(err)
 	}
 }
 
+// Transfer moves Sum between two accounts at the bank. A transfer with a
+// Reference is applied once however many times it is sent.
 type Transfer struct {
+	From      uuid.UUID
+	To        uuid.UUID
+	Currency  CurrencyCode
+	Unit      UnitType
+	Sum       int
+	Reference uuid.UUID
 }
 
+// AdminTransfer moves money between two accounts at the bank in one request.
+// The money is either moved or left where it was.
 func (b Bank) AdminTransfer(req micro.Request, t Transfer) {
-	_ = req.Respond([]byte("unimplemented"))
+	if t.Sum <= 0 {
+		respondError(req, "transfer failed: sum must be positive")
+		return
+	}
+	if t.From == uuid.Nil || t.To == uuid.Nil || t.From == t.To {
+		respondError(req, "transfer failed: needs two different accounts")
+		return
+	}
+	minorSum, err := b.ConvertCurrency(t.Currency, t.Unit, Minor, t.Sum)
+	if err != nil {
+		respondError(req, err.Error())
+		return
+	}
+	err = b.once(t.Reference, func() error {
+		return b.transfer(t.From, t.To, t.Currency, minorSum, false)
+	})
+	if err != nil {
+		respondPaymentError(req, err)
+		return
+	}
+	if err := req.RespondJSON(Response{Status: "OK"}); err != nil {
+		log.Println(err)
+	}
+}
+
+// Withdrawal takes Sum out of an account. A withdrawal with a Reference is
+// applied once however many times it is sent.
+type Withdrawal struct {
+	AccountID uuid.UUID
+	Currency  CurrencyCode
+	Unit      UnitType
+	Sum       int
+	Reference uuid.UUID
+}
+
+func (b Bank) AdminWithdraw(req micro.Request, w Withdrawal) {
+	if w.Sum <= 0 {
+		respondError(req, "withdrawal failed: sum must be positive")
+		return
+	}
+	minorSum, err := b.ConvertCurrency(w.Currency, w.Unit, Minor, w.Sum)
+	if err != nil {
+		respondError(req, err.Error())
+		return
+	}
+	err = b.once(w.Reference, func() error {
+		return b.withdraw(w.AccountID, w.Currency, minorSum)
+	})
+	if err != nil {
+		respondPaymentError(req, err)
+		return
+	}
+	if err := req.RespondJSON(Response{Status: "OK"}); err != nil {
+		log.Println(err)
+	}
 }
 
 type Hold struct {
+	AccountID uuid.UUID
+	Currency  CurrencyCode
+	Unit      UnitType
+	Sum       int
 }
 
+// AdminHold puts some of an account's available funds on hold.
 func (b Bank) AdminHold(req micro.Request, h Hold) {
-	_ = req.Respond([]byte("unimplemented"))
+	if h.Sum <= 0 {
+		respondError(req, "hold failed: sum must be positive")
+		return
+	}
+	minorSum, err := b.ConvertCurrency(h.Currency, h.Unit, Minor, h.Sum)
+	if err != nil {
+		respondError(req, err.Error())
+		return
+	}
+	if err := b.hold(h.AccountID, h.Currency, minorSum); err != nil {
+		respondError(req, err.Error())
+		return
+	}
+	if err := req.RespondJSON(Response{Status: "OK"}); err != nil {
+		log.Println(err)
+	}
+}
+
+// Subject is the subject of a customer endpoint of the given bank.
+func Subject(countryCode, bankCode, endpoint string) string {
+	return fmt.Sprintf("bank.%s.%s.%s", countryCode, bankCode, endpoint)
+}
+
+// AdminSubject is the subject of an admin endpoint of the given bank.
+func AdminSubject(countryCode, bankCode, endpoint string) string {
+	return fmt.Sprintf("admin.bank.%s.%s.%s", countryCode, bankCode, endpoint)
 }
 
 func (b Bank) accountBucket() string {
 	return fmt.Sprintf("bank-accounts-%s-%s-%d", b.CountryCode, b.Code, b.ID)
 }
 
+func (b Bank) paymentBucket() string {
+	return fmt.Sprintf("bank-payments-%s-%s-%d", b.CountryCode, b.Code, b.ID)
+}
+
 func (b Bank) customerBucket() string {
 	return fmt.Sprintf("bank-customers-%s-%s-%d", b.CountryCode, b.Code, b.ID)
 }
@@ -2,12 +2,15 @@ package broker
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	"strings"
 
 	"github.com/google/uuid"
 	"github.com/nats-io/nats.go"
 
+	"github.com/jxlxx/GreenIsland/bank"
 	"github.com/jxlxx/GreenIsland/config"
 )
 
@@ -42,14 +45,12 @@ func (b Broker) Put(userID uuid.UUID, securityID string, status Availability, va
 	if err != nil {
 		return err
 	}
-	key := fmt.Sprintf("%s.%s.%s", userID.String(), securityID, string(status))
-	_, err = b.accounts.Put(key, v)
+	_, err = b.accounts.Put(holdingKey(userID, securityID, status), v)
 	return err
 }
 
 func (b Broker) Get(userID uuid.UUID, securityID string, status Availability) (int, error) {
-	key := fmt.Sprintf("%s.%s.%s", userID.String(), securityID, string(status))
-	v, err := b.accounts.Get(key)
+	v, err := b.accounts.Get(holdingKey(userID, securityID, status))
 	if err != nil {
 		return 0, err
 	}
@@ -58,45 +59,187 @@ func (b Broker) Get(userID uuid.UUID, securityID string, status Availability) (i
 	return i, err
 }
 
+// casRetries is how many times a holding is updated again after losing a
+// race with another writer before giving up.
+const casRetries = 100
+
+func holdingKey(userID uuid.UUID, securityID string, status Availability) string {
+	return fmt.Sprintf("%s.%s.%s", userID.String(), securityID, string(status))
+}
+
+// update changes a holding to what fn makes of it. The new holding is only
+// written if nobody else wrote one since it was read, otherwise fn is applied
+// again to the newer holding. A missing holding starts from zero if create
+// is set.
+func (b Broker) update(userID uuid.UUID, securityID string, status Availability, create bool, fn func(int) (int, error)) error {
+	k := holdingKey(userID, securityID, status)
+	for i := 0; i < casRetries; i++ {
+		current, revision := 0, uint64(0)
+		entry, err := b.accounts.Get(k)
+		switch {
+		case errors.Is(err, nats.ErrKeyNotFound) && create:
+		case err != nil:
+			return err
+		default:
+			if err := json.Unmarshal(entry.Value(), &current); err != nil {
+				return err
+			}
+			revision = entry.Revision()
+		}
+		next, err := fn(current)
+		if err != nil {
+			return err
+		}
+		v, err := json.Marshal(next)
+		if err != nil {
+			return err
+		}
+		if revision == 0 {
+			_, err = b.accounts.Create(k, v)
+		} else {
+			_, err = b.accounts.Update(k, v, revision)
+		}
+		if err == nil {
+			return nil
+		}
+		if !isConflict(err) {
+			return err
+		}
+	}
+	return fmt.Errorf("err: %s kept changing, gave up after %d tries", k, casRetries)
+}
+
+// isConflict reports whether a write lost to another writer.
+func isConflict(err error) bool {
+	var apiErr *nats.APIError
+	return errors.Is(err, nats.ErrKeyExists) ||
+		(errors.As(err, &apiErr) && apiErr.ErrorCode == nats.JSErrCodeStreamWrongLastSequence)
+}
+
+func (b Broker) debit(userID uuid.UUID, securityID string, status Availability, sum int, insufficient string) error {
+	return b.update(userID, securityID, status, false, func(current int) (int, error) {
+		if current-sum < 0 {
+			return 0, errors.New(insufficient)
+		}
+		return current - sum, nil
+	})
+}
+
+func (b Broker) credit(userID uuid.UUID, securityID string, status Availability, sum int) error {
+	return b.update(userID, securityID, status, true, func(current int) (int, error) {
+		return current + sum, nil
+	})
+}
+
+// move takes securities out of one holding and adds them to another. If
+// they cannot be added they are put back, so securities are never created
+// or destroyed.
+func (b Broker) move(from, to uuid.UUID, securityID string, out, in Availability, sum int, insufficient string) error {
+	if err := b.debit(from, securityID, out, sum, insufficient); err != nil {
+		return err
+	}
+	if err := b.credit(to, securityID, in, sum); err != nil {
+		if err := b.credit(from, securityID, out, sum); err != nil {
+			log.Println(err)
+		}
+		return err
+	}
+	return nil
+}
+
 func (b Broker) Transfer(give, recv uuid.UUID, securityID string, sum int, fromOnHold bool) error {
 	status := Available
 	if fromOnHold {
 		status = OnHold
 	}
-	current, err := b.Get(give, securityID, status)
-	remainder := current - sum
+	return b.move(give, recv, securityID, status, Available, sum, "transfer failed: insufficient funds")
+}
+
+// Credit adds to a user's available holding of a security.
+func (b Broker) Credit(userID uuid.UUID, securityID string, sum int) error {
+	return b.credit(userID, securityID, Available, sum)
+}
+
+// Hold puts some of a user's available holding of a security on hold, on top
+// of what is already on hold.
+func (b Broker) Hold(user uuid.UUID, securityID string, sum int) error {
+	return b.move(user, user, securityID, Available, OnHold, sum, "hold failed: insufficient available securities to put on hold")
+}
+
+// Release makes securities on hold available again.
+func (b Broker) Release(user uuid.UUID, securityID string, sum int) error {
+	return b.move(user, user, securityID, OnHold, Available, sum, "release failed: insufficient securities on hold")
+}
+
+// Holders lists everyone holding a security, available or on hold.
+func (b Broker) Holders(securityID string) (map[uuid.UUID]int, error) {
+	holders := map[uuid.UUID]int{}
+	keys, err := b.accounts.Keys()
+	if errors.Is(err, nats.ErrNoKeysFound) {
+		return holders, nil
+	}
 	if err != nil {
-		return err
+		return nil, err
 	}
-	if remainder < 0 {
-		return fmt.Errorf("transfer failed: insufficient funds")
+	for _, key := range keys {
+		parts := strings.Split(key, ".")
+		if len(parts) != 3 || parts[1] != securityID {
+			continue
+		}
+		user, err := uuid.Parse(parts[0])
+		if err != nil {
+			continue
+		}
+		sum, err := b.Get(user, securityID, Availability(parts[2]))
+		if err != nil {
+			return nil, err
+		}
+		if sum > 0 {
+			holders[user] += sum
+		}
 	}
+	return holders, nil
+}
 
-	if err := b.Put(give, securityID, status, remainder); err != nil {
-		return err
-	}
-	if err := b.Put(recv, securityID, Available, sum); err != nil {
+// SetSettlement records the bank account a user's cash from securities, such
+// as dividends, is paid into.
+func (b Broker) SetSettlement(userID uuid.UUID, account bank.AccountRef) error {
+	v, err := json.Marshal(account)
+	if err != nil {
 		return err
 	}
-	return nil
+	_, err = b.accounts.Put(fmt.Sprintf("%s.settlement", userID.String()), v)
+	return err
 }
 
-func (b Broker) Hold(user uuid.UUID, securityID string, sum int) error {
-	current, err := b.Get(user, securityID, Available)
-	remainder := current - sum
+func (b Broker) Settlement(userID uuid.UUID) (bank.AccountRef, error) {
+	account := bank.AccountRef{}
+	v, err := b.accounts.Get(fmt.Sprintf("%s.settlement", userID.String()))
 	if err != nil {
-		return err
-	}
-	if remainder < 0 {
-		return fmt.Errorf("hold failed: insufficient available securities to put on hold")
+		return account, err
 	}
+	err = json.Unmarshal(v.Value(), &account)
+	return account, err
+}
 
-	if err := b.Put(user, securityID, Available, remainder); err != nil {
-		return err
+// Cancel removes every holding of a security, available or on hold.
+func (b Broker) Cancel(securityID string) error {
+	keys, err := b.accounts.Keys()
+	if errors.Is(err, nats.ErrNoKeysFound) {
+		return nil
 	}
-	if err := b.Put(user, securityID, OnHold, sum); err != nil {
+	if err != nil {
 		return err
 	}
+	for _, key := range keys {
+		parts := strings.Split(key, ".")
+		if len(parts) != 3 || parts[1] != securityID {
+			continue
+		}
+		if err := b.accounts.Delete(key); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
@@ -0,0 +1,101 @@
+package broker
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/nats-io/nats-server/v2/server"
+	"github.com/nats-io/nats.go"
+)
+
+func testBroker(t *testing.T) Broker {
+	t.Helper()
+	opts := &server.Options{
+		Host:      "127.0.0.1",
+		Port:      -1,
+		JetStream: true,
+		StoreDir:  t.TempDir(),
+		NoLog:     true,
+		NoSigs:    true,
+	}
+	ns, err := server.NewServer(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go ns.Start()
+	if !ns.ReadyForConnections(5 * time.Second) {
+		t.Fatal("nats server not ready")
+	}
+	t.Cleanup(ns.Shutdown)
+	nc, err := nats.Connect(ns.ClientURL())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(nc.Close)
+	js, err := nc.JetStream()
+	if err != nil {
+		t.Fatal(err)
+	}
+	accounts, err := js.CreateKeyValue(&nats.KeyValueConfig{Bucket: "test_holdings"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return Broker{bucket: "test_holdings", js: js, accounts: accounts}
+}
+
+func TestConcurrentTransfersConserveShares(t *testing.T) {
+	b := testBroker(t)
+	const (
+		security = "TEST"
+		holders  = 5
+		opening  = 1000
+		workers  = 20
+		rounds   = 25
+	)
+	ids := make([]uuid.UUID, holders)
+	for i := range ids {
+		ids[i] = uuid.New()
+		if err := b.Credit(ids[i], security, opening); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for r := 0; r < rounds; r++ {
+				give := ids[(w+r)%holders]
+				recv := ids[(w+2*r+1)%holders]
+				// Too few shares is expected; only conservation matters.
+				_ = b.Transfer(give, recv, security, 1+(w*r)%300, false)
+				_ = b.Hold(give, security, 1+r%7)
+				_ = b.Transfer(give, recv, security, 1+r%5, true)
+				_ = b.Release(recv, security, 1+r%3)
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	for _, id := range ids {
+		for _, status := range []Availability{Available, OnHold} {
+			if held, err := b.Get(id, security, status); err == nil && held < 0 {
+				t.Errorf("%s has a negative %s holding: %d", id, status, held)
+			}
+		}
+	}
+	held, err := b.Holders(security)
+	if err != nil {
+		t.Fatal(err)
+	}
+	total := 0
+	for _, shares := range held {
+		total += shares
+	}
+	if total != holders*opening {
+		t.Errorf("shares were not conserved: got %d, want %d", total, holders*opening)
+	}
+}
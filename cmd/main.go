@@ -29,6 +29,10 @@ func main() {
 			}
 		}()
 	}
+	if err := nc.Flush(); err != nil {
+		log.Println(err)
+	}
+	w.SetCountryBankAccounts()
 	w.SetCompanyBankAccounts()
 	if err := w.Run(); err != nil {
 		log.Fatalln(err)
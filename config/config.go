@@ -1,9 +1,11 @@
 package config
 
 import (
+	"bytes"
 	"fmt"
 	"log"
 	"os"
+	"text/template"
 
 	"github.com/nats-io/nats.go"
 	"gopkg.in/yaml.v3"
@@ -67,3 +69,20 @@ func ReadConfig(filename string, conf interface{}) {
 		log.Fatalln("err unmarshal: ", err)
 	}
 }
+
+// ReadTemplate fills in a yaml template with data before reading it.
+func ReadTemplate(filename string, data, conf interface{}) error {
+	wd, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+	t, err := template.ParseFiles(fmt.Sprintf("%s%s", wd, filename))
+	if err != nil {
+		return err
+	}
+	var b bytes.Buffer
+	if err := t.Execute(&b, data); err != nil {
+		return err
+	}
+	return yaml.Unmarshal(b.Bytes(), conf)
+}
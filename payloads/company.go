@@ -1,6 +1,10 @@
 package payloads
 
-import "github.com/jxlxx/GreenIsland/bank"
+import (
+	"github.com/google/uuid"
+
+	"github.com/jxlxx/GreenIsland/bank"
+)
 
 type QuarterlyCompanyUpdate struct {
 	Name         string `json:"name"`
@@ -10,16 +14,24 @@ type QuarterlyCompanyUpdate struct {
 	BalanceSheet BalanceSheet
 	IncomeSheet  Income
 	Dividends    Dividends
+	PerShare     PerShare
+	Shares       ShareActivity
+	Quote        Quote
+	Subsidiaries []Subsidiary
+	Earnings     Earnings
+	Ratios       Ratios
 }
 
 type BalanceSheet struct {
 	Assets      Assets
 	Liabilities Liabilities
+	Equity      Equity
 }
 
 type Assets struct {
 	CurrencyUnit         bank.UnitType
 	Liquid               int
+	ForeignCash          int
 	MarketableSecurities int
 	AccountsReceivables  int
 	Inventory            int
@@ -38,18 +50,287 @@ type Liabilities struct {
 	DeferredTaxes   int
 	ShortTermDebts  int
 	LongTermDebts   int
+
+	DividendsPayable int
+}
+
+type Equity struct {
+	CurrencyUnit     bank.UnitType
+	ShareCapital     int
+	RetainedEarnings int
+	TreasuryStock    int
+	Total            int
 }
 
 type Income struct {
 	CurrencyUnit           bank.UnitType
 	OperatingRevenue       int
+	Exports                int
 	NonOperatingRevenue    int
 	ProductionExpenses     int
 	AdministrativeExpenses int
 	Depreciation           int
+	Wages                  int
+	Interest               int
+	FXTranslation          int
+	NetIncome              int
+}
+
+type Subsidiary struct {
+	CountryCode  string
+	CurrencyCode bank.CurrencyCode
+	CurrencyUnit bank.UnitType
+	Revenue      int
+	Expenses     int
+	Cash         int
+	Carried      int
+}
+
+type Earnings struct {
+	ReportDay        int
+	Analysts         int
+	RevenueConsensus int
+	Revenue          int
+	RevenueSurprise  int
+	EPSConsensus     int
+	EPS              int
+	EPSSurprise      int
+}
+
+type EarningsDate struct {
+	Company          string
+	Quarter          int
+	ReportDay        int
+	CurrencyCode     bank.CurrencyCode
+	Analysts         int
+	RevenueConsensus int
+	EPSConsensus     int
+}
+
+type Ratios struct {
+	CurrentRatio   float64
+	QuickRatio     float64
+	DebtToEquity   float64
+	GrossMargin    float64
+	NetMargin      float64
+	ReturnOnEquity float64
+	ReturnOnAssets float64
+	PriceEarnings  float64
+	DividendYield  float64
+	PayoutRatio    float64
+}
+
+type PerShare struct {
+	CurrencyUnit      bank.UnitType
+	OutstandingShares int
+	EPS               int
+	BookValue         int
+	PayoutRatio       int
 }
 
 type Dividends struct {
 	CurrencyUnit bank.UnitType
 	Payout       int
 }
+
+type Quote struct {
+	CurrencyUnit bank.UnitType
+	Bid          int
+	Ask          int
+	FairValue    int
+}
+
+type ShareActivity struct {
+	CurrencyUnit   bank.UnitType
+	BuybackOrder   int
+	Repurchased    int
+	RepurchaseCost int
+	Issued         int
+	IssueProceeds  int
+	TreasuryShares int
+}
+
+type DividendUpdate struct {
+	Company      string
+	Status       string
+	Quarter      int
+	CurrencyCode bank.CurrencyCode
+	CurrencyUnit bank.UnitType
+	PerShareUnit bank.UnitType
+	PerShare     int
+	Declared     int
+	RecordDay    int
+	PaymentDay   int
+	Shareholders int
+	Paid         int
+	Failures     []DividendFailure
+}
+
+type DividendFailure struct {
+	Holder uuid.UUID
+	Amount int
+	Error  string
+}
+
+type PayrollUpdate struct {
+	Company      string
+	Day          int
+	Employees    int
+	CurrencyCode bank.CurrencyCode
+	CurrencyUnit bank.UnitType
+	Amount       int
+	Status       string
+	Error        string
+}
+
+type LoanUpdate struct {
+	Company      string
+	Bank         string
+	Status       string
+	Message      string
+	CurrencyCode bank.CurrencyCode
+	CurrencyUnit bank.UnitType
+	Principal    int
+	Outstanding  int
+	Rate         int
+	Payment      int
+	Maturity     int
+}
+
+type BankruptcyUpdate struct {
+	Company           string
+	Day               int
+	Status            string
+	Reason            string
+	CurrencyCode      bank.CurrencyCode
+	CurrencyUnit      bank.UnitType
+	AssetsSold        int
+	Proceeds          int
+	Creditors         []CreditorClaim
+	SharesIssued      int
+	Shareholders      int
+	ShareholderPayout int
+}
+
+type CreditorClaim struct {
+	Class string
+	Owed  int
+	Paid  int
+	Error string
+}
+
+type CompanyFounding struct {
+	Name        string
+	FullName    string
+	Code        string
+	CountryCode string
+	Industry    string
+	Capital     int
+	Founder     bank.AccountRef
+}
+
+type IPORequest struct {
+	Code string
+}
+
+type IPOUpdate struct {
+	Company      string
+	Status       string
+	Quarter      int
+	CurrencyCode bank.CurrencyCode
+	CurrencyUnit bank.UnitType
+	Offered      int
+	Low          int
+	High         int
+	Price        int
+	Orders       int
+	Investors    int
+	Sold         int
+	Proceeds     int
+}
+
+type ShareOrder struct {
+	ID           uuid.UUID
+	Company      string
+	Side         string
+	Status       string
+	CurrencyCode bank.CurrencyCode
+	CurrencyUnit bank.UnitType
+	Price        int
+	Shares       int
+	Filled       int
+}
+
+type OrderFill struct {
+	Company string
+	OrderID uuid.UUID
+	Seller  uuid.UUID
+	Shares  int
+}
+
+type OrderFillResponse struct {
+	Status  string
+	Message string
+	Shares  int
+	Price   int
+}
+
+type TenderOffer struct {
+	Acquirer      string
+	Target        string
+	Premium       int
+	Consideration string
+}
+
+type TenderAcceptance struct {
+	Target string
+	Holder uuid.UUID
+	Shares int
+}
+
+type TenderAcceptanceResponse struct {
+	Status  string
+	Message string
+	Shares  int
+	Price   int
+}
+
+type TenderUpdate struct {
+	Acquirer         string
+	Target           string
+	Status           string
+	Day              int
+	Consideration    string
+	CurrencyCode     bank.CurrencyCode
+	CurrencyUnit     bank.UnitType
+	Price            int
+	Premium          int
+	Expiry           int
+	Accepted         int
+	Holders          int
+	Shares           int
+	SharesIssued     int
+	Cost             int
+	Goodwill         int
+	AcquirerCurrency bank.CurrencyCode
+	Message          string
+}
+
+type CreditRatios struct {
+	Leverage  int
+	Coverage  int
+	Liquidity int
+}
+
+type RatingRequest struct {
+	Code string
+}
+
+type RatingUpdate struct {
+	Company  string
+	Quarter  int
+	Rating   string
+	Previous string
+	Action   string
+	Ratios   CreditRatios
+}
@@ -7,7 +7,18 @@ type QuarterlyCountryUpdate struct {
 	Quarter           int
 	TotalPopulation   int
 	WorkingPopulation int
+	Demographics      Demographics
 	MoneySupply       MoneySupply
+	Budget            Budget
+	CentralBank       CentralBankReport
+	BusinessCycle     string
+}
+
+type BusinessCycleUpdate struct {
+	Country string
+	Quarter int
+	From    string
+	To      string
 }
 
 type MoneySupply struct {
@@ -18,3 +29,66 @@ type MoneySupply struct {
 	M2              int
 	M3              int
 }
+
+type Budget struct {
+	Currency     bank.CurrencyCode
+	CurrencyUnit bank.UnitType
+	Revenue      int
+	Tariffs      int
+	Subsidies    int
+	PublicWages  int
+	Interest     int
+	Balance      int
+	Issued       int
+	Redeemed     int
+	Debt         int
+	GDP          int
+	DebtToGDP    float64
+}
+
+type BondSubscription struct {
+	Account bank.AccountRef `json:"account"`
+	Bonds   int             `json:"bonds"`
+}
+
+type Demographics struct {
+	Births       int
+	Deaths       int
+	NetMigration int
+	Unemployment int
+	Cohorts      []Cohort
+}
+
+type Cohort struct {
+	MinAge     int
+	MaxAge     int
+	Population int
+}
+
+type CentralBankReport struct {
+	Name            string
+	Currency        bank.CurrencyCode
+	CurrencyUnit    bank.UnitType
+	InterestRate    int
+	Reserve         int
+	BondsHeld       int
+	BondsBought     int
+	BondsSold       int
+	DiscountLending int
+	Repaid          int
+	Reserves        []BankReserves
+	Operations      []CentralBankOperation
+}
+
+type BankReserves struct {
+	Bank     string
+	Deposits int
+	Required int
+	Held     int
+}
+
+type CentralBankOperation struct {
+	Kind         string
+	Counterparty string
+	Amount       int
+}
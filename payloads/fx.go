@@ -0,0 +1,28 @@
+package payloads
+
+import "github.com/jxlxx/GreenIsland/bank"
+
+type FXRate struct {
+	Base  bank.CurrencyCode
+	Quote bank.CurrencyCode
+	Rate  float64
+	EGT   int
+}
+
+type FXQuoteRequest struct {
+	From   bank.CurrencyCode `json:"from"`
+	To     bank.CurrencyCode `json:"to"`
+	Unit   bank.UnitType     `json:"unit"`
+	Amount int               `json:"amount"`
+	EGT    int               `json:"egt"`
+}
+
+type FXQuote struct {
+	From      bank.CurrencyCode `json:"from"`
+	To        bank.CurrencyCode `json:"to"`
+	Unit      bank.UnitType     `json:"unit"`
+	Amount    int               `json:"amount"`
+	Converted int               `json:"converted"`
+	Rate      float64           `json:"rate"`
+	EGT       int               `json:"egt"`
+}
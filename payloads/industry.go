@@ -0,0 +1,16 @@
+package payloads
+
+import "github.com/jxlxx/GreenIsland/bank"
+
+type QuarterlyIndustryUpdate struct {
+	Industry     string
+	Quarter      int
+	Demand       int
+	Capacity     int
+	Sold         int
+	Utilization  float64
+	Producers    int
+	Currency     bank.CurrencyCode
+	CurrencyUnit bank.UnitType
+	Price        int
+}
@@ -0,0 +1,23 @@
+package payloads
+
+import "github.com/jxlxx/GreenIsland/bank"
+
+type QuarterlyTradeUpdate struct {
+	Country    string
+	Quarter    int
+	Currency   bank.CurrencyCode
+	Exports    []TradeFlow
+	Imports    []TradeFlow
+	Balance    map[bank.CurrencyCode]int
+	NetBalance int
+}
+
+type TradeFlow struct {
+	Exporter     string
+	Importer     string
+	Industry     string
+	Currency     bank.CurrencyCode
+	CurrencyUnit bank.UnitType
+	Value        int
+	Tariff       int
+}
@@ -11,3 +11,13 @@ type WorldTick struct {
 	EGT     int
 	ERT     time.Duration
 }
+
+// Days is the number of whole game days since the world started.
+func (t WorldTick) Days() int {
+	return t.EGT / 24
+}
+
+// Quarters is the number of whole game quarters since the world started.
+func (t WorldTick) Quarters() int {
+	return t.EGT / 24 / 90
+}
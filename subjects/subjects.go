@@ -9,8 +9,25 @@ const (
 	TickDay     Subject = "event.time.new.day"
 	TickQuarter Subject = "event.time.new.quarter"
 
-	quarterlyCountryUpdate Subject = "news.country.%s.Q%d"
-	quarterlyCompanyUpdate Subject = "news.company.%s.Q%d"
+	quarterlyCountryUpdate  Subject = "news.country.%s.Q%d"
+	quarterlyCompanyUpdate  Subject = "news.company.%s.Q%d"
+	quarterlyTradeUpdate    Subject = "news.trade.%s.Q%d"
+	quarterlyIndustryUpdate Subject = "news.industry.%s.Q%d"
+	businessCycle           Subject = "news.country.%s.cycle"
+	dividend                Subject = "news.company.%s.dividend"
+	payroll                 Subject = "news.company.%s.payroll"
+	loan                    Subject = "news.company.%s.loan"
+	bankruptcy              Subject = "news.company.%s.bankruptcy"
+	founded                 Subject = "news.company.%s.founded"
+	ipo                     Subject = "news.company.%s.ipo"
+	tender                  Subject = "news.company.%s.tender"
+	earningsDate            Subject = "news.company.%s.earnings"
+
+	rating Subject = "news.rating.%s"
+
+	fxRate Subject = "market.fx.%s.%s"
+
+	order Subject = "orders.%s.%s"
 )
 
 func (s Subject) String() string {
@@ -28,3 +45,59 @@ func QuarterlyCountryUpdate(code string, quarter int) string {
 func QuarterlyCompanyUpdate(code string, quarter int) string {
 	return fmt.Sprintf(quarterlyCompanyUpdate.String(), code, quarter)
 }
+
+func QuarterlyTradeUpdate(code string, quarter int) string {
+	return fmt.Sprintf(quarterlyTradeUpdate.String(), code, quarter)
+}
+
+func FXRate(base, quote string) string {
+	return fmt.Sprintf(fxRate.String(), base, quote)
+}
+
+func Order(code, side string) string {
+	return fmt.Sprintf(order.String(), code, side)
+}
+
+func BusinessCycle(code string) string {
+	return fmt.Sprintf(businessCycle.String(), code)
+}
+
+func QuarterlyIndustryUpdate(industry string, quarter int) string {
+	return fmt.Sprintf(quarterlyIndustryUpdate.String(), industry, quarter)
+}
+
+func Dividend(code string) string {
+	return fmt.Sprintf(dividend.String(), code)
+}
+
+func Payroll(code string) string {
+	return fmt.Sprintf(payroll.String(), code)
+}
+
+func Loan(code string) string {
+	return fmt.Sprintf(loan.String(), code)
+}
+
+func Bankruptcy(code string) string {
+	return fmt.Sprintf(bankruptcy.String(), code)
+}
+
+func Founded(code string) string {
+	return fmt.Sprintf(founded.String(), code)
+}
+
+func IPO(code string) string {
+	return fmt.Sprintf(ipo.String(), code)
+}
+
+func Tender(code string) string {
+	return fmt.Sprintf(tender.String(), code)
+}
+
+func EarningsDate(code string) string {
+	return fmt.Sprintf(earningsDate.String(), code)
+}
+
+func Rating(code string) string {
+	return fmt.Sprintf(rating.String(), code)
+}
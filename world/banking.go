@@ -4,7 +4,7 @@ import (
 	"github.com/jxlxx/GreenIsland/payloads"
 )
 
-func (c Country) CalculateMoneySupply() payloads.MoneySupply {
+func (c *Country) CalculateMoneySupply() payloads.MoneySupply {
 	m1 := c.CalculateM1()
 	m2 := c.CalculateM2()
 	m3 := c.CalculateM3()
@@ -17,17 +17,17 @@ func (c Country) CalculateMoneySupply() payloads.MoneySupply {
 	}
 }
 
-func (c Country) CalculateM1() int {
+func (c *Country) CalculateM1() int {
 	sum := 0
 	// get info from bank
 	return sum
 }
-func (c Country) CalculateM2() int {
+func (c *Country) CalculateM2() int {
 	sum := 0
 	// get info from bank (traders)
 	return sum
 }
-func (c Country) CalculateM3() int {
+func (c *Country) CalculateM3() int {
 	sum := 0
 	// get info from bank (companies)
 	return sum
@@ -0,0 +1,389 @@
+package world
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/google/uuid"
+
+	"github.com/jxlxx/GreenIsland/bank"
+	"github.com/jxlxx/GreenIsland/payloads"
+	"github.com/jxlxx/GreenIsland/subjects"
+)
+
+// Insolvency sets when a company goes bankrupt and what is left of it. It is
+// bankrupt after MissedPayrolls payrolls or MissedLoanPayments loan payments
+// in a row, or as soon as its equity is negative; a zero count never
+// triggers. In a liquidation its assets other than cash sell for Recovery
+// basis points of their book value. In a restructuring its lenders take
+// CreditorShare basis points of the company for their loans.
+type Insolvency struct {
+	MissedPayrolls     int `yaml:"missed_payrolls"`
+	MissedLoanPayments int `yaml:"missed_loan_payments"`
+	Recovery           int `yaml:"recovery"`
+	CreditorShare      int `yaml:"creditor_share"`
+}
+
+// liquidatedAssets are sold off in a liquidation to the households of the
+// company's country. Cash is what they are sold for.
+var liquidatedAssets = []LedgerAccount{
+	MarketableSecuritiesAccount,
+	AccountsReceivablesAccount,
+	InventoryAccount,
+	PrepaidExpensesAccount,
+	CapitalAssetsAccount,
+	IntangibleAssetsAccount,
+	InvestmentsAccount,
+}
+
+// tradeCreditors rank after employees and the bank.
+var tradeCreditors = []LedgerAccount{
+	AccountsPayableAccount,
+	DeferredRevenueAccount,
+	DeferredTaxesAccount,
+}
+
+// insolvent gives the reason the company is bankrupt, or "" if it is not.
+// The caller holds c.mu.
+func (c *Company) insolvent() string {
+	i := c.Insolvency
+	switch {
+	case i.MissedPayrolls > 0 && c.missedPayrolls >= i.MissedPayrolls:
+		return fmt.Sprintf("missed %d payrolls", c.missedPayrolls)
+	case i.MissedLoanPayments > 0 && c.missedLoanPayments >= i.MissedLoanPayments:
+		return fmt.Sprintf("missed %d loan payments", c.missedLoanPayments)
+	case c.ledger.Equity() < 0:
+		return "negative equity"
+	}
+	return ""
+}
+
+// bankrupt restructures a company whose business still earns more than it
+// costs to run but which owes the bank, and liquidates any other. The caller
+// holds c.mu throughout, so nothing else deals with the company while its
+// creditors are paid.
+func (c *Company) bankrupt(reason string, day int) {
+	update := payloads.BankruptcyUpdate{Reason: reason, Day: day}
+	c.publishBankruptcy("bankrupt", update)
+	if len(c.loans) > 0 && c.runRateEarnings()+c.quarterlyInterest() > 0 {
+		c.restructure(day, update)
+		return
+	}
+	c.liquidate(day, update)
+}
+
+// lender is the house account of the company's bank.
+func (c *Company) lender() (bank.AccountRef, error) {
+	if c.country != nil {
+		for _, b := range c.country.CommercialBanks {
+			if b.Code == c.BankCode {
+				return b.House(), nil
+			}
+		}
+	}
+	return bank.AccountRef{}, fmt.Errorf("err: no bank %s for %s", c.BankCode, c.Code)
+}
+
+func (c *Company) settleLoan(l *companyLoan, sum, day int) (bank.LoanResponse, error) {
+	settlement := bank.LoanSettlement{Reference: uuid.New(), LoanID: l.ID, Day: day, Sum: sum}
+	subject := bank.AdminSubject(c.account.CountryCode, c.account.BankCode, "settle")
+	return loanRequest(c.nc, subject, settlement)
+}
+
+// restructure swaps the company's bank loans for new shares, diluting the
+// old shareholders down to what the bank leaves them. The company carries
+// on with a distressed strategy.
+func (c *Company) restructure(day int, update payloads.BankruptcyUpdate) {
+	lender, err := c.lender()
+	if err != nil {
+		log.Println(err)
+		c.liquidate(day, update)
+		return
+	}
+	claim := payloads.CreditorClaim{Class: "bank loans"}
+	kept := []*companyLoan{}
+	for _, l := range c.loans {
+		resp, err := c.settleLoan(l, 0, day)
+		if err != nil {
+			claim.Error = err.Error()
+			kept = append(kept, l)
+			continue
+		}
+		claim.Owed += resp.WrittenOff
+		c.book(l.debtAccount(), ShareCapitalAccount, l.Outstanding, "debt converted to equity")
+		c.book(InterestPayableAccount, ShareCapitalAccount, l.accrued, "debt converted to equity")
+	}
+	c.loans = kept
+	update.Creditors = append(update.Creditors, claim)
+
+	share := min(c.Insolvency.CreditorShare, 9999)
+	if share > 0 && claim.Owed > 0 && c.broker != nil {
+		shares := proportion(c.OutstandingShares, share, 10000-share)
+		if err := c.broker.SetSettlement(lender.AccountID, lender); err != nil {
+			log.Println(c.Code, err)
+		}
+		if err := c.broker.Credit(lender.AccountID, c.Code, shares); err != nil {
+			log.Println(c.Code, err)
+		} else {
+			c.OutstandingShares += shares
+			update.SharesIssued = shares
+		}
+	}
+	c.missedPayrolls = 0
+	c.missedLoanPayments = 0
+	c.strategy = Distressed{}
+	c.BalanceSheet.sync(c.ledger)
+	c.publishBankruptcy("restructured", update)
+}
+
+// liquidate sells the company's assets, pays its creditors in order of
+// priority, hands whatever is left to its shareholders and cancels its
+// shares. What cannot be paid is written off. The caller holds c.mu.
+func (c *Company) liquidate(day int, update payloads.BankruptcyUpdate) {
+	c.repatriateAll()
+	if c.dividend != nil {
+		c.book(DividendsPayableAccount, RetainedEarningsAccount, c.ledger.Balance(DividendsPayableAccount), "dividend cancelled")
+		c.dividend = nil
+	}
+	c.sellAssets(&update)
+	update.Creditors = append(update.Creditors, c.payWages(), c.payLoans(day, "in liquidation"), c.payTradeCreditors())
+	c.payShareholders(&update)
+	if c.broker != nil {
+		if err := c.broker.Cancel(c.Code); err != nil {
+			log.Println(c.Code, err)
+		}
+	}
+	c.OutstandingShares = 0
+	c.closed = true
+	c.BalanceSheet.sync(c.ledger)
+	c.publishBankruptcy("liquidated", update)
+	if c.onClose != nil {
+		c.onClose(c.Code)
+	}
+}
+
+func (c *Company) sellAssets(update *payloads.BankruptcyUpdate) {
+	proceeds := map[LedgerAccount]int{}
+	total := 0
+	for _, a := range liquidatedAssets {
+		held := c.ledger.Balance(a)
+		if held <= 0 {
+			continue
+		}
+		proceeds[a] = proportion(held, c.Insolvency.Recovery, 10000)
+		total += proceeds[a]
+		update.AssetsSold += held
+	}
+	if total > 0 {
+		if err := c.sellToHouseholds(total); err != nil {
+			log.Println(c.Code, err)
+			proceeds, total = nil, 0
+		}
+	}
+	for _, a := range liquidatedAssets {
+		held := c.ledger.Balance(a)
+		c.book(LiquidAssetsAccount, a, proceeds[a], "sold in liquidation")
+		c.book(WriteOffsAccount, a, held-proceeds[a], "written off in liquidation")
+	}
+	update.Proceeds = total
+}
+
+// sellToHouseholds has the households pay for the company's assets. If they
+// cannot, the assets are written off without a sale.
+func (c *Company) sellToHouseholds(sum int) error {
+	if c.country == nil {
+		return fmt.Errorf("err: no buyer for the assets of %s", c.Code)
+	}
+	return pay(c.nc, c.country.households, c.account, money(c.DefaultCurrency, sum))
+}
+
+// payWages pays what is owed to employees first.
+func (c *Company) payWages() payloads.CreditorClaim {
+	owed := c.ledger.Balance(WagesPayableAccount)
+	claim := payloads.CreditorClaim{Class: "employees", Owed: owed}
+	paid := min(owed, c.ledger.Balance(LiquidAssetsAccount))
+	if paid > 0 && c.country != nil {
+		if err := pay(c.nc, c.account, c.country.households, money(c.DefaultCurrency, paid)); err != nil {
+			claim.Error = err.Error()
+			paid = 0
+		}
+	}
+	claim.Paid = max(0, paid)
+	c.book(WagesPayableAccount, LiquidAssetsAccount, claim.Paid, "wages paid in liquidation")
+	c.book(WagesPayableAccount, DebtForgivenAccount, owed-claim.Paid, "written off in liquidation")
+	return claim
+}
+
+// payLoans settles every bank loan for what cash is left, interest first.
+// When says why, for the memos.
+func (c *Company) payLoans(day int, when string) payloads.CreditorClaim {
+	claim := payloads.CreditorClaim{Class: "bank loans"}
+	for _, l := range c.loans {
+		resp, err := c.settleLoan(l, max(0, c.ledger.Balance(LiquidAssetsAccount)), day)
+		if err != nil {
+			claim.Error = err.Error()
+			claim.Owed += l.Outstanding + l.accrued
+			continue
+		}
+		paid := resp.Interest + resp.Principal
+		claim.Owed += paid + resp.WrittenOff
+		claim.Paid += paid
+		c.book(InterestAccount, InterestPayableAccount, resp.Loan.Accrued-l.accrued, "interest charged")
+		c.book(InterestPayableAccount, LiquidAssetsAccount, resp.Interest, "interest paid "+when)
+		c.book(l.debtAccount(), LiquidAssetsAccount, resp.Principal, "principal paid "+when)
+		c.book(InterestPayableAccount, DebtForgivenAccount, resp.Loan.Accrued-resp.Interest, "written off "+when)
+		c.book(l.debtAccount(), DebtForgivenAccount, resp.Loan.Outstanding-resp.Principal, "written off "+when)
+	}
+	c.loans = nil
+	return claim
+}
+
+// payTradeCreditors pays suppliers and the rest of the company's liabilities
+// last of all creditors. Open supply invoices are paid to their sellers in
+// proportion to what is paid of the payables, and the rest goes to the
+// households the company owes.
+func (c *Company) payTradeCreditors() payloads.CreditorClaim {
+	claim := payloads.CreditorClaim{Class: "trade creditors"}
+	cash := max(0, c.ledger.Balance(LiquidAssetsAccount))
+	owed := map[LedgerAccount]int{}
+	claims := []int{}
+	for _, a := range tradeCreditors {
+		owed[a] = max(0, c.ledger.Balance(a))
+		claims = append(claims, owed[a])
+		claim.Owed += owed[a]
+	}
+	paid := map[LedgerAccount]int{}
+	for i, sum := range waterfall(cash, claims) {
+		paid[tradeCreditors[i]] = sum
+	}
+	invoiced := 0
+	for _, inv := range c.payables {
+		invoiced += inv.owed.Value
+	}
+	payable := paid[AccountsPayableAccount]
+	onInvoices := proportion(invoiced, payable, owed[AccountsPayableAccount])
+	paid[AccountsPayableAccount] = payable - onInvoices
+	others := 0
+	for _, a := range tradeCreditors {
+		others += paid[a]
+	}
+	if others > 0 {
+		err := fmt.Errorf("err: no households to pay for %s", c.Code)
+		if c.country != nil {
+			err = pay(c.nc, c.account, c.country.households, money(c.DefaultCurrency, others))
+		}
+		if err != nil {
+			claim.Error = err.Error()
+			paid = map[LedgerAccount]int{}
+		}
+	}
+	paid[AccountsPayableAccount] += c.payInvoices(payable, owed[AccountsPayableAccount])
+	for _, a := range tradeCreditors {
+		claim.Paid += paid[a]
+		c.book(a, LiquidAssetsAccount, paid[a], "paid in liquidation")
+		c.book(a, DebtForgivenAccount, c.ledger.Balance(a), "written off in liquidation")
+	}
+	return claim
+}
+
+// waterfall shares cash out between claims in order of priority: each claim
+// is paid in full before the next one gets anything.
+func waterfall(cash int, claims []int) []int {
+	paid := make([]int, len(claims))
+	for i, owed := range claims {
+		paid[i] = max(0, min(owed, cash))
+		cash -= paid[i]
+	}
+	return paid
+}
+
+// payInvoices pays each open supply invoice's seller its share of what is
+// paid of the payables and returns how much that came to. The sellers book
+// the payment when they settle the invoice.
+func (c *Company) payInvoices(paid, owed int) int {
+	sum := 0
+	for _, inv := range c.payables {
+		out := proportion(inv.owed.Value, paid, owed)
+		in := proportion(inv.billed.Value, paid, owed)
+		if out <= 0 {
+			continue
+		}
+		if err := transfer(c.nc, c.account, inv.seller.account, money(c.DefaultCurrency, out), money(inv.seller.DefaultCurrency, in)); err != nil {
+			log.Println(c.Code, err)
+			continue
+		}
+		inv.paid = in
+		sum += out
+	}
+	return sum
+}
+
+// payShareholders shares out whatever cash is left over.
+func (c *Company) payShareholders(update *payloads.BankruptcyUpdate) {
+	cash := c.ledger.Balance(LiquidAssetsAccount)
+	if cash <= 0 || c.broker == nil {
+		return
+	}
+	holders, err := c.broker.Holders(c.Code)
+	if err != nil {
+		log.Println(c.Code, err)
+		return
+	}
+	delete(holders, c.id)
+	total := 0
+	for _, shares := range holders {
+		total += shares
+	}
+	update.Shareholders = len(holders)
+	for holder, shares := range holders {
+		amount := proportion(cash, shares, total)
+		if amount <= 0 {
+			continue
+		}
+		if err := c.payShareholder(holder, amount); err != nil {
+			log.Println(c.Code, err)
+			continue
+		}
+		c.book(ShareCapitalAccount, LiquidAssetsAccount, amount, "liquidation distribution")
+		update.ShareholderPayout += amount
+	}
+}
+
+func (c *Company) publishBankruptcy(status string, update payloads.BankruptcyUpdate) {
+	update.Company = c.Code
+	update.Status = status
+	update.CurrencyCode = c.DefaultCurrency
+	update.CurrencyUnit = bank.Minor
+	if err := c.nc.Publish(subjects.Bankruptcy(c.Code), update); err != nil {
+		fmt.Println(err)
+	}
+}
+
+// liquidated takes a liquidated company out of the world. The company still
+// holds its own lock, so it is removed once the lock is let go.
+func (w *World) liquidated(code string) {
+	go w.removeCompany(code)
+}
+
+// removeCompany stops a closed company and takes it out of the world and its
+// country.
+func (w *World) removeCompany(code string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	remaining := []*Company{}
+	for _, c := range w.companies {
+		if c.Code != code {
+			remaining = append(remaining, c)
+			continue
+		}
+		for _, sub := range c.subs {
+			if err := sub.Unsubscribe(); err != nil {
+				log.Println(err)
+			}
+		}
+		if c.country != nil {
+			c.country.removeCompany(c)
+		}
+	}
+	w.companies = remaining
+}
@@ -0,0 +1,68 @@
+package world
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestInsolvent(t *testing.T) {
+	tests := []struct {
+		name     string
+		payrolls int
+		loans    int
+		losses   int
+		expected string
+	}{
+		{"solvent", 1, 1, 0, ""},
+		{"missed payrolls", 2, 0, 0, "missed 2 payrolls"},
+		{"missed loan payments", 0, 3, 0, "missed 3 loan payments"},
+		{"negative equity", 0, 0, 500, "negative equity"},
+		{"payrolls come first", 2, 3, 500, "missed 2 payrolls"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &Company{
+				Insolvency:         Insolvency{MissedPayrolls: 2, MissedLoanPayments: 3},
+				ledger:             NewLedger("USD"),
+				missedPayrolls:     tt.payrolls,
+				missedLoanPayments: tt.loans,
+			}
+			if err := c.ledger.Post(AdministrativeExpensesAccount, AccountsPayableAccount, tt.losses, "test"); err != nil {
+				t.Fatal(err)
+			}
+			if got := c.insolvent(); got != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestInsolventNeverTriggeredByZeroCounts(t *testing.T) {
+	c := &Company{ledger: NewLedger("USD"), missedPayrolls: 10, missedLoanPayments: 10}
+	if got := c.insolvent(); got != "" {
+		t.Errorf("expected a solvent company, got %q", got)
+	}
+}
+
+func TestWaterfall(t *testing.T) {
+	tests := []struct {
+		name     string
+		cash     int
+		claims   []int
+		expected []int
+	}{
+		{"everyone paid", 1000, []int{300, 200, 100}, []int{300, 200, 100}},
+		{"last in line goes short", 450, []int{300, 200, 100}, []int{300, 150, 0}},
+		{"first in line takes it all", 250, []int{300, 200, 100}, []int{250, 0, 0}},
+		{"nothing to pay with", 0, []int{300, 200}, []int{0, 0}},
+		{"overdrawn", -100, []int{300}, []int{0}},
+		{"nothing owed", 1000, []int{0, 200}, []int{0, 200}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := waterfall(tt.cash, tt.claims); !slices.Equal(got, tt.expected) {
+				t.Errorf("expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
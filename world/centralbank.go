@@ -0,0 +1,168 @@
+package world
+
+import (
+	"log"
+
+	"github.com/jxlxx/GreenIsland/bank"
+	"github.com/jxlxx/GreenIsland/payloads"
+	"github.com/jxlxx/GreenIsland/types"
+)
+
+// CentralBank holds its reserve in a settlement account at one of the
+// country's commercial banks, which is not counted as a deposit of that
+// bank. Every quarter it runs open market operations in sovereign bonds
+// according to the business cycle, checks each commercial bank holds
+// ReserveRequirement basis points of its deposits and lends any shortfall
+// through the discount window at the policy rate plus DiscountSpread basis
+// points.
+type CentralBank struct {
+	Name               string             `yaml:"name"`
+	BankCode           string             `yaml:"bank_code"`
+	Reserve            bank.CurrencyValue `yaml:"reserve"`
+	InterestRate       types.Value        `yaml:"interest_rate"`
+	ReserveRequirement int                `yaml:"reserve_requirement"`
+	DiscountSpread     int                `yaml:"discount_spread"`
+	OpenMarket         bank.CurrencyValue `yaml:"open_market"`
+
+	account bank.AccountRef
+	balance int
+	loans   []discountLoan
+}
+
+type discountLoan struct {
+	bank      *bank.Bank
+	principal int
+	rate      int
+}
+
+// interestRate is the central bank's policy rate in basis points.
+func (c *Country) interestRate() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.CentralBank.InterestRate.Value
+}
+
+func (c *Country) openCentralBankAccount() {
+	cb := &c.CentralBank
+	b, err := c.commercialBank(cb.BankCode)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	cb.account = b.SettlementAccount("central-bank")
+	if err := deposit(c.nc, cb.account, cb.Reserve); err != nil {
+		log.Fatalln(err)
+	}
+	cb.balance = toMinor(cb.Reserve)
+}
+
+// RunCentralBank collects last quarter's discount window loans, runs this
+// quarter's open market operation and then tops up any commercial bank
+// short of its reserve requirement.
+func (c *Country) RunCentralBank(p payloads.WorldTick) payloads.CentralBankReport {
+	cb := &c.CentralBank
+	report := payloads.CentralBankReport{
+		Name:         cb.Name,
+		Currency:     c.Currency,
+		CurrencyUnit: bank.Minor,
+		InterestRate: cb.InterestRate.Value,
+	}
+	record := func(kind string, b *bank.Bank, amount int) {
+		report.Operations = append(report.Operations, payloads.CentralBankOperation{
+			Kind:         kind,
+			Counterparty: b.Code,
+			Amount:       amount,
+		})
+	}
+
+	loans := cb.loans
+	cb.loans = nil
+	for _, l := range loans {
+		due := l.principal + l.principal*l.rate/10000/4
+		if err := pay(c.nc, l.bank.House(), cb.account, money(c.Currency, due)); err != nil {
+			log.Println(err)
+			cb.loans = append(cb.loans, l)
+			continue
+		}
+		cb.balance += due
+		report.Repaid += due
+		record("discount_repayment", l.bank, due)
+	}
+
+	size := toMinor(cb.OpenMarket)
+	for _, b := range c.CommercialBanks {
+		switch c.BusinessCycle.Phase {
+		case Recession, Trough:
+			if bought := c.tradeBonds(b.House(), cb.account, size/len(c.CommercialBanks)); bought > 0 {
+				cb.balance -= bought
+				report.BondsBought += bought
+				record("bond_purchase", b, bought)
+			}
+		case Peak:
+			if sold := c.tradeBonds(cb.account, b.House(), size/len(c.CommercialBanks)); sold > 0 {
+				cb.balance += sold
+				report.BondsSold += sold
+				record("bond_sale", b, sold)
+			}
+		}
+	}
+
+	for _, b := range c.CommercialBanks {
+		deposits, err := b.TotalDeposits(c.Currency)
+		if err != nil {
+			log.Println(err)
+			continue
+		}
+		reserves, err := b.Reserves(c.Currency)
+		if err != nil {
+			log.Println(err)
+			continue
+		}
+		required := deposits * cb.ReserveRequirement / 10000
+		report.Reserves = append(report.Reserves, payloads.BankReserves{
+			Bank:     b.Code,
+			Deposits: deposits,
+			Required: required,
+			Held:     reserves,
+		})
+		if reserves >= required {
+			continue
+		}
+		shortfall := required - reserves
+		if err := pay(c.nc, cb.account, b.House(), money(c.Currency, shortfall)); err != nil {
+			log.Println(err)
+			continue
+		}
+		cb.balance -= shortfall
+		cb.loans = append(cb.loans, discountLoan{
+			bank:      b,
+			principal: shortfall,
+			rate:      cb.InterestRate.Value + cb.DiscountSpread,
+		})
+		report.DiscountLending += shortfall
+		record("discount_loan", b, shortfall)
+	}
+
+	cb.Reserve.Value = proportion(cb.balance, 1, toMinor(bank.CurrencyValue{
+		Currency: cb.Reserve.Currency,
+		Unit:     cb.Reserve.Unit,
+		Value:    1,
+	}))
+	report.Reserve = cb.balance
+	report.BondsHeld = c.Treasury.held(cb.account)
+	return report
+}
+
+// tradeBonds moves up to face of bonds from seller to buyer and has the buyer
+// pay for them at par. It returns the face value that changed hands.
+func (c *Country) tradeBonds(seller, buyer bank.AccountRef, face int) int {
+	moved := c.Treasury.reassign(seller, buyer, face)
+	if moved == 0 {
+		return 0
+	}
+	if err := pay(c.nc, buyer, seller, money(c.Currency, moved)); err != nil {
+		log.Println(err)
+		c.Treasury.reassign(buyer, seller, moved)
+		return 0
+	}
+	return moved
+}
@@ -1,18 +1,16 @@
 package world
 
 import (
-	"encoding/json"
 	"fmt"
 	"log"
-	"time"
+	"sync"
 
 	"github.com/google/uuid"
 	"github.com/nats-io/nats.go"
 
 	"github.com/jxlxx/GreenIsland/bank"
-	"github.com/jxlxx/GreenIsland/config"
+	"github.com/jxlxx/GreenIsland/broker"
 	"github.com/jxlxx/GreenIsland/payloads"
-	"github.com/jxlxx/GreenIsland/subjects"
 	"github.com/jxlxx/GreenIsland/types"
 )
 
@@ -24,6 +22,7 @@ type Company struct {
 	BankCode        string            `yaml:"bank_code"`
 	DefaultCurrency bank.CurrencyCode `yaml:"currency_code"`
 
+	Private           bool         `yaml:"private"`
 	OutstandingShares int          `yaml:"outstanding_shares"`
 	BalanceSheet      BalanceSheet `yaml:"balance_sheet"`
 	Income            Income       `yaml:"income"`
@@ -34,146 +33,522 @@ type Company struct {
 	QuarterlyBehaviour QuarterlyBehaviour `yaml:"quarterly_behaviour"`
 	QuarterlyMetrics   QuarterlyMetrics   `yaml:"quarterly_metrics"`
 
-	Employment Employment `yaml:"employment"`
-	Industries Industries `yaml:"industries"`
-
-	nc *nats.EncodedConn
-	id uuid.UUID
+	Employment   Employment    `yaml:"employment"`
+	Industries   Industries    `yaml:"industries"`
+	Valuation    Valuation     `yaml:"valuation"`
+	Strategy     string        `yaml:"strategy"`
+	Insolvency   Insolvency    `yaml:"insolvency"`
+	IPO          IPO           `yaml:"ipo"`
+	Acquisitions Acquisitions  `yaml:"acquisitions"`
+	Subsidiaries []*Subsidiary `yaml:"subsidiaries"`
+	Earnings     Earnings      `yaml:"earnings"`
+
+	nc       *nats.EncodedConn
+	subs     []*nats.Subscription
+	broker   *broker.Broker
+	fx       *FXMarket
+	hour     int
+	country  *Country
+	onClose  func(code string)
+	id       uuid.UUID
+	account  bank.AccountRef
+	ledger   *Ledger
+	dividend *dividend
+	buyback  *buyback
+	strategy Strategy
+	cycle    CycleEffect
+	pricing  int
+	borrow   int
+
+	households     func() []bank.AccountRef
+	repurchased    int
+	repurchaseCost int
+
+	payday         int
+	missedPayrolls int
+
+	loans              []*companyLoan
+	application        *bank.LoanApplication
+	missedLoanPayments int
+	closed             bool
+
+	purchases          int
+	supplies           int
+	invoicesPayable    int
+	invoicesReceivable int
+	payables           []*invoice
+
+	consensus *consensus
+	earnings  *earningsReport
+	surprise  int
+	rating    string
+
+	founder         bank.AccountRef
+	quartersPrivate int
+	listing         bool
+	mu              sync.Mutex
 }
 
-func (c *Company) InitializeCompany() {
-	nc := config.Connect()
-	defer func() {
-		if err := nc.Drain(); err != nil {
-			fmt.Println(err)
-		}
-	}()
+const daysPerQuarter = 90
+
+// InitializeCompany opens the company's bank account with its liquid assets,
+// paid in by its founder if it has one.
+func (c *Company) InitializeCompany() error {
 	c.id = uuid.New()
-	req := bank.NewAccountRequest{
-		UserID: c.id,
+	c.account = bank.AccountRef{
+		CountryCode: c.HQCountryCode,
+		BankCode:    c.BankCode,
+		AccountID:   c.id,
+	}
+	var err error
+	if c.founder.AccountID != uuid.Nil {
+		err = pay(c.nc, c.founder, c.account, c.BalanceSheet.Assets.LiquidAssets)
+	} else {
+		err = deposit(c.nc, c.account, c.BalanceSheet.Assets.LiquidAssets)
+	}
+	if err != nil {
+		return err
+	}
+	if err := c.openSubsidiaries(); err != nil {
+		return err
+	}
+	c.seedShareholders()
+	return nil
+}
+
+// receive books money that has been paid into the company's bank account
+// against the given revenue account.
+func (c *Company) receive(v bank.CurrencyValue, credit LedgerAccount, memo string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.book(LiquidAssetsAccount, credit, toMinor(v), memo)
+	c.BalanceSheet.sync(c.ledger)
+}
+
+// book posts an entry to the ledger. The caller holds c.mu.
+func (c *Company) book(debit, credit LedgerAccount, amount int, memo string) {
+	if err := c.ledger.Post(debit, credit, amount, memo); err != nil {
+		log.Println(c.Code, err)
 	}
-	resp, err := nc.Request("%s.%s.create", payloads.Bytes(req), time.Second)
+}
+
+// unlocked runs f without c.mu, for requests to a bank that can keep the
+// caller waiting for seconds. The caller holds c.mu and must not count on
+// anything it read before f still being so after.
+func (c *Company) unlocked(f func()) {
+	c.mu.Unlock()
+	defer c.mu.Lock()
+	f()
+}
+
+// daily is a day's share of a quarterly amount, in minor units.
+func daily(v bank.CurrencyValue) int {
+	return toMinor(v) / daysPerQuarter
+}
+
+// keepBooks posts one day of trading. Sales and expenses are on account,
+// with the production the company buys in from suppliers invoiced by them; a
+// thirtieth of receivables is collected and a thirtieth of payables is paid
+// each day. The net cash is paid by or to the country's households, who are
+// the company's customers and suppliers. Subsidiaries trade on their own.
+// Supply invoices are left to be settled on their own terms.
+// Capital assets are replaced as fast as they depreciate.
+func (c *Company) keepBooks() {
+	i := c.Income
+	c.book(AccountsReceivablesAccount, OperatingRevenueAccount, daily(i.OperatingRevenue), "sales")
+	c.book(ProductionExpensesAccount, AccountsPayableAccount, c.ownProduction()/daysPerQuarter, "production")
+	c.book(AdministrativeExpensesAccount, AccountsPayableAccount, daily(i.AdministrativeExpenses), "administration")
+	depreciation := daily(i.Depreciation)
+	c.book(DepreciationAccount, CapitalAssetsAccount, depreciation, "depreciation")
+	c.book(CapitalAssetsAccount, AccountsPayableAccount, depreciation, "capital expenditure")
+
+	nonOperating := daily(i.NonOperatingRevenue)
+	collected := max(0, c.ledger.Balance(AccountsReceivablesAccount)-c.invoicesReceivable) / 30
+	paid := max(0, c.ledger.Balance(AccountsPayableAccount)-c.invoicesPayable) / 30
+	var err error
+	c.unlocked(func() { err = c.settleDay(nonOperating + collected - paid) })
 	if err != nil {
-		log.Fatalln(err)
+		log.Println(c.Code, err)
+	} else {
+		c.book(LiquidAssetsAccount, NonOperatingRevenueAccount, nonOperating, "non-operating")
+		c.book(LiquidAssetsAccount, AccountsReceivablesAccount, collected, "collections")
+		c.book(AccountsPayableAccount, LiquidAssetsAccount, paid, "payments")
 	}
-	account := bank.Account{}
-	if err := json.Unmarshal(resp.Data, &account); err != nil {
-		log.Fatalln(err)
+	if c.fx != nil {
+		c.tradeAbroad(c.hour)
 	}
-	r := bank.Deposit{
-		AccountID: account.AccountID,
-		Currency:  c.BalanceSheet.Assets.LiquidAssets.Currency,
-		Unit:      c.BalanceSheet.Assets.LiquidAssets.Unit,
-		Sum:       c.BalanceSheet.Assets.LiquidAssets.Value,
+}
+
+// settleDay moves a day's net cash between the households and the company.
+func (c *Company) settleDay(cash int) error {
+	if c.country == nil {
+		return fmt.Errorf("err: no households to trade with for %s", c.Code)
 	}
-	subject := fmt.Sprintf("admin.%s.%s.deposit", c.HQCountryCode, c.BankCode)
-	fmt.Println(subject)
-	if _, err := nc.Request(subject, payloads.Bytes(r), time.Second); err != nil {
-		log.Fatalln(err)
+	if cash >= 0 {
+		return pay(c.nc, c.country.households, c.account, money(c.DefaultCurrency, cash))
 	}
+	return pay(c.nc, c.account, c.country.households, money(c.DefaultCurrency, -cash))
+}
+
+// reconcile checks the books against the company's bank account. A payment
+// still on its way on another tick can put them out for a moment. The
+// caller holds c.mu.
+func (c *Company) reconcile() error {
+	var cash int
+	var err error
+	c.unlocked(func() { cash, err = balance(c.nc, c.account, c.DefaultCurrency) })
+	if err != nil {
+		return err
+	}
+	return c.ledger.Reconcile(cash)
+}
+
+// industryRevenue is the part of the company's operating revenue earned in
+// one of its primary industries.
+func (c *Company) industryRevenue(industry Industry) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed || !c.Industries.IsPrimary(industry) {
+		return 0
+	}
+	return toMinor(c.Income.OperatingRevenue) / len(c.Industries.PrimaryIndustries)
+}
+
+// export books the quarter's export sales, which have already been paid into
+// the company's bank account.
+func (c *Company) export(v bank.CurrencyValue) {
+	c.receive(v, ExportsAccount, "exports")
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	exports := &c.Income.Exports
+	sum, err := bank.Convert(v.Currency, v.Unit, exports.Unit, v.Value)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	exports.Value = sum
+}
+
+func (c *Company) capacity(industry Industry) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed || !c.Industries.IsPrimary(industry) {
+		return 0
+	}
+	return c.Industries.Capacity[industry]
+}
+
+// marketShare weighs how much demand the company wins. Every basis point it
+// prices below the market wins it two more of share, and every one above
+// loses it two.
+func (c *Company) marketShare(industry Industry, capacity int) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	share := capacity
+	if s, ok := c.Industries.MarketShare[industry]; ok {
+		share = s
+	}
+	return max(0, proportion(share, 10000-2*c.pricing, 10000))
+}
+
+// sell sets the quarter's operating revenue to what the company sold in the
+// industry markets at its own price.
+func (c *Company) sell(v bank.CurrencyValue) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	revenue := &c.Income.OperatingRevenue
+	sum, err := bank.Convert(v.Currency, v.Unit, revenue.Unit, proportion(v.Value, 10000+c.pricing, 10000))
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	revenue.Value = sum
 }
 
 func (c *Company) DailySubscriber() func(payloads.WorldTick) {
-	return func(payloads.WorldTick) {
-		c.DailyUpdate()
+	return func(p payloads.WorldTick) {
+		c.DailyUpdate(p.EGT)
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		if c.closed {
+			return
+		}
+		c.payrollDay(p.Days())
+		c.loanDay(p.Days())
+		if c.closed {
+			return
+		}
+		if reason := c.insolvent(); reason != "" {
+			c.bankrupt(reason, p.Days())
+		}
+		if c.closed {
+			return
+		}
+		c.dividendDay(p.Days())
+		c.earningsDay(p.Days())
 	}
 }
 
 func (c *Company) QuarterlySubscriber() func(payloads.WorldTick) {
 	return func(p payloads.WorldTick) {
+		outlook := c.outlook()
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		if c.closed {
+			return
+		}
+		shares := payloads.ShareActivity{CurrencyUnit: bank.Minor}
+		if !c.Private {
+			c.repurchase(&shares)
+			c.raiseCapital(&shares)
+		}
+		if c.broker != nil {
+			shares.TreasuryShares = c.treasuryShares()
+		}
+		if c.fx != nil {
+			c.repatriate(p.EGT)
+		}
+		if err := c.reconcile(); err != nil {
+			log.Println(c.Code, err)
+		}
+		if c.closed {
+			return
+		}
+		income := c.CreateIncome()
+		perShare := c.CreatePerShare()
+		c.ledger.Close()
+		c.BalanceSheet.sync(c.ledger)
 		update := payloads.QuarterlyCompanyUpdate{
 			Name:         c.Name,
 			Quarter:      p.Quarter,
 			CurrencyCode: c.DefaultCurrency,
 			Employees:    c.Employment.Employees.Value,
 			BalanceSheet: c.CreateBalanceSheet(),
-			IncomeSheet:  c.CreateIncome(),
+			IncomeSheet:  income,
 			Dividends:    c.CreateDividends(),
+			PerShare:     perShare,
+			Shares:       shares,
+			Quote:        c.CreateQuote(),
+			Subsidiaries: c.CreateSubsidiaries(),
 		}
-
-		if err := c.nc.Publish(subjects.QuarterlyCompanyUpdate(c.Code, p.Quarter), update); err != nil {
-			fmt.Println(err)
+		update.Ratios = CreateRatios(update)
+		c.scheduleEarnings(update, p.Days())
+		c.decideQuarterly(c.strategy.Quarterly(c.situation(outlook)))
+		c.borrowFromBank(c.borrow, p.Days())
+		if !c.Private && !c.closed {
+			c.declareDividend(p)
 		}
 	}
 }
 
-func (c Company) CreateBalanceSheet() payloads.BalanceSheet {
+func (c *Company) CreateBalanceSheet() payloads.BalanceSheet {
 	return payloads.BalanceSheet{
 		Assets:      c.CreateAssets(),
 		Liabilities: c.CreateLiabilities(),
+		Equity:      c.CreateEquity(),
 	}
 }
 
-func (c Company) CreateAssets() payloads.Assets {
-	a := c.BalanceSheet.Assets
+func (c *Company) CreateAssets() payloads.Assets {
+	l := c.ledger
 	return payloads.Assets{
-		CurrencyUnit:         a.LiquidAssets.Unit,
-		Liquid:               a.LiquidAssets.Value,
-		MarketableSecurities: a.MarketableSecurities.Value,
-		AccountsReceivables:  a.AccountsReceivables.Value,
-		Inventory:            a.Inventory.Value,
-		PrepaidExpenses:      a.PrepaidExpenses.Value,
-		CapitalAssets:        a.CapitalAssets.Value,
-		IntangibleAssets:     a.IntangibleAssets.Value,
-		Investments:          a.Investments.Value,
-	}
-}
-func (c Company) CreateLiabilities() payloads.Liabilities {
-	l := c.BalanceSheet.Liabilities
+		CurrencyUnit:         bank.Minor,
+		Liquid:               l.Balance(LiquidAssetsAccount),
+		ForeignCash:          l.Balance(ForeignCashAccount),
+		MarketableSecurities: l.Balance(MarketableSecuritiesAccount),
+		AccountsReceivables:  l.Balance(AccountsReceivablesAccount),
+		Inventory:            l.Balance(InventoryAccount),
+		PrepaidExpenses:      l.Balance(PrepaidExpensesAccount),
+		CapitalAssets:        l.Balance(CapitalAssetsAccount),
+		IntangibleAssets:     l.Balance(IntangibleAssetsAccount),
+		Investments:          l.Balance(InvestmentsAccount),
+	}
+}
+func (c *Company) CreateLiabilities() payloads.Liabilities {
+	l := c.ledger
 	return payloads.Liabilities{
-		CurrencyUnit:    l.AccountsPayable.Unit,
-		AccountsPayable: l.AccountsPayable.Value,
-		WagesPayable:    l.WagesPayable.Value,
-		InterestPayable: l.InterestPayable.Value,
-		DeferredRevenue: l.DeferredRevenue.Value,
-		DeferredTaxes:   l.DeferredTaxes.Value,
-		ShortTermDebts:  l.ShortTermDebts.Value,
-		LongTermDebts:   l.LongTermDebts.Value,
+		CurrencyUnit:    bank.Minor,
+		AccountsPayable: l.Balance(AccountsPayableAccount),
+		WagesPayable:    l.Balance(WagesPayableAccount),
+		InterestPayable: l.Balance(InterestPayableAccount),
+		DeferredRevenue: l.Balance(DeferredRevenueAccount),
+		DeferredTaxes:   l.Balance(DeferredTaxesAccount),
+		ShortTermDebts:  l.Balance(ShortTermDebtsAccount),
+		LongTermDebts:   l.Balance(LongTermDebtsAccount),
+
+		DividendsPayable: l.Balance(DividendsPayableAccount),
 	}
 }
-func (c Company) CreateIncome() payloads.Income {
-	i := c.Income
+
+func (c *Company) CreateEquity() payloads.Equity {
+	l := c.ledger
+	return payloads.Equity{
+		CurrencyUnit:     bank.Minor,
+		ShareCapital:     l.Balance(ShareCapitalAccount),
+		RetainedEarnings: l.Balance(RetainedEarningsAccount),
+		TreasuryStock:    l.Balance(TreasuryStockAccount),
+		Total:            l.Equity(),
+	}
+}
+
+// CreatePerShare reports the quarter's earnings and the book value per
+// outstanding share in micro units. PayoutRatio is the dividend as a share of
+// earnings, in basis points.
+func (c *Company) CreatePerShare() payloads.PerShare {
+	micro, err := bank.Convert(c.DefaultCurrency, bank.Minor, bank.Micro, 1)
+	if err != nil {
+		log.Println(err)
+	}
+	shares := c.OutstandingShares
+	p := payloads.PerShare{
+		CurrencyUnit:      bank.Micro,
+		OutstandingShares: shares,
+		EPS:               proportion(c.ledger.NetIncome(), micro, shares),
+		BookValue:         proportion(c.ledger.Equity(), micro, shares),
+	}
+	dividend := toMicro(c.QuarterlyBehaviour.DividendPayout)
+	if p.EPS > 0 {
+		p.PayoutRatio = proportion(dividend, 10000, p.EPS)
+	}
+	return p
+}
+
+func (c *Company) CreateQuote() payloads.Quote {
+	return payloads.Quote{
+		CurrencyUnit: c.Bid.Unit,
+		Bid:          c.Bid.Value,
+		Ask:          c.Ask.Value,
+		FairValue:    c.fromMicro(c.fairValue(), c.Bid.Unit),
+	}
+}
+
+// CreateIncome reports what has been booked this quarter.
+func (c *Company) CreateIncome() payloads.Income {
+	l := c.ledger
 	return payloads.Income{
-		CurrencyUnit:           i.OperatingRevenue.Unit,
-		OperatingRevenue:       i.OperatingRevenue.Value,
-		NonOperatingRevenue:    i.NonOperatingRevenue.Value,
-		ProductionExpenses:     i.ProductionExpenses.Value,
-		AdministrativeExpenses: i.AdministrativeExpenses.Value,
-		Depreciation:           i.Depreciation.Value,
+		CurrencyUnit:           bank.Minor,
+		OperatingRevenue:       l.Balance(OperatingRevenueAccount),
+		Exports:                l.Balance(ExportsAccount),
+		NonOperatingRevenue:    l.Balance(NonOperatingRevenueAccount),
+		ProductionExpenses:     l.Balance(ProductionExpensesAccount),
+		AdministrativeExpenses: l.Balance(AdministrativeExpensesAccount),
+		Depreciation:           l.Balance(DepreciationAccount),
+		Wages:                  l.Balance(WagesAccount),
+		Interest:               l.Balance(InterestAccount),
+		FXTranslation:          l.Balance(FXTranslationAccount),
+		NetIncome:              l.NetIncome(),
 	}
 }
 
-func (c Company) CreateDividends() payloads.Dividends {
+func (c *Company) CreateDividends() payloads.Dividends {
 	return payloads.Dividends{
 		CurrencyUnit: c.QuarterlyBehaviour.DividendPayout.Unit,
 		Payout:       c.QuarterlyBehaviour.DividendPayout.Value,
 	}
 }
 
-func (c *Company) DailyUpdate() {
-	c.BalanceSheet = c.BalanceSheet.Update()
+// outlook is read before taking c.mu, since a company never locks its
+// country while holding its own lock.
+func (c *Company) outlook() Outlook {
+	if c.country == nil {
+		return Outlook{}
+	}
+	return c.country.outlook()
+}
+
+func (c *Company) DailyUpdate(hour int) {
+	outlook := c.outlook()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return
+	}
+	c.hour = hour
+	c.applyCycle(outlook.Effect)
 	c.Income = c.Income.Update()
 	c.QuarterlyBehaviour = c.QuarterlyBehaviour.Update()
 	c.QuarterlyMetrics = c.QuarterlyMetrics.Update()
 	c.Employment = c.Employment.Update()
+	c.decideDaily(c.strategy.Daily(c.situation(outlook)))
+	c.keepBooks()
+	c.BalanceSheet.sync(c.ledger)
+	c.QuarterlyMetrics.ProjectedDividends = c.projectedDividend()
 	c.Bid, c.Ask = c.UpdateBidAsk()
 }
 
-func (c Company) UpdateBidAsk() (bank.CurrencyValue, bank.CurrencyValue) {
-	return c.Bid, c.Ask
+// applyCycle shifts the daily drift of revenue, headcount and the dividend by
+// the effect of the country's phase of the cycle, in place of the effect of
+// the phase before. The caller holds c.mu.
+func (c *Company) applyCycle(effect CycleEffect) {
+	c.Income.OperatingRevenue.Average += effect.Revenue - c.cycle.Revenue
+	c.Employment.Employees.Average += effect.Employment - c.cycle.Employment
+	c.QuarterlyBehaviour.DividendPayout.Average += effect.Dividends - c.cycle.Dividends
+	c.cycle = effect
 }
 
 type BalanceSheet struct {
 	Assets      Assets      `yaml:"assets"`
 	Liabilities Liabilities `yaml:"liabilities"`
+	Equity      Equity      `yaml:"equity"`
+}
+
+func (b *BalanceSheet) lines() map[LedgerAccount]*bank.CurrencyValue {
+	a, l, e := &b.Assets, &b.Liabilities, &b.Equity
+	return map[LedgerAccount]*bank.CurrencyValue{
+		LiquidAssetsAccount:         &a.LiquidAssets,
+		MarketableSecuritiesAccount: &a.MarketableSecurities,
+		AccountsReceivablesAccount:  &a.AccountsReceivables,
+		InventoryAccount:            &a.Inventory,
+		PrepaidExpensesAccount:      &a.PrepaidExpenses,
+		CapitalAssetsAccount:        &a.CapitalAssets,
+		IntangibleAssetsAccount:     &a.IntangibleAssets,
+		InvestmentsAccount:          &a.Investments,
+		AccountsPayableAccount:      &l.AccountsPayable,
+		WagesPayableAccount:         &l.WagesPayable,
+		InterestPayableAccount:      &l.InterestPayable,
+		DeferredRevenueAccount:      &l.DeferredRevenue,
+		DeferredTaxesAccount:        &l.DeferredTaxes,
+		ShortTermDebtsAccount:       &l.ShortTermDebts,
+		LongTermDebtsAccount:        &l.LongTermDebts,
+		ShareCapitalAccount:         &e.ShareCapital,
+		RetainedEarningsAccount:     &e.RetainedEarnings,
+		TreasuryStockAccount:        &e.TreasuryStock,
+	}
 }
 
-func (b BalanceSheet) Update() BalanceSheet {
-	b.Assets = b.Assets.Update()
-	b.Liabilities = b.Liabilities.Update()
-	return b
+// open starts a ledger from the configured balance sheet, with share capital
+// taking up the difference.
+func (b *BalanceSheet) open(code bank.CurrencyCode) *Ledger {
+	l := NewLedger(code)
+	for account, v := range b.lines() {
+		if account == ShareCapitalAccount {
+			continue
+		}
+		switch ledgerAccounts[account] {
+		case liabilityAccount, equityAccount:
+			l.Post(ShareCapitalAccount, account, toMinor(*v), "opening balance")
+		default:
+			l.Post(account, ShareCapitalAccount, toMinor(*v), "opening balance")
+		}
+	}
+	l.Close()
+	return l
 }
 
+// sync copies the ledger balances back into the balance sheet.
+func (b *BalanceSheet) sync(l *Ledger) {
+	for account, v := range b.lines() {
+		sum, err := bank.Convert(v.Currency, bank.Minor, v.Unit, l.Balance(account))
+		if err != nil {
+			log.Println(err)
+			continue
+		}
+		v.Value = sum
+	}
+}
+
+// Employment sets the workforce. Wages accrue every day at the average
+// salary and are paid every PayrollDays.
 type Employment struct {
 	Employees            types.Value        `yaml:"employees"`
 	EmployeeSatisfaction types.Value        `yaml:"employee_satisfaction"`
@@ -181,10 +556,11 @@ type Employment struct {
 	HighestAnnualSalary  bank.CurrencyValue `yaml:"highest_annual_salary"`
 	AverageAnnualSalary  bank.CurrencyValue `yaml:"average_annual_salary"`
 	LowestAnnualSalary   bank.CurrencyValue `yaml:"lowest_annual_salary"`
+	PayrollDays          int                `yaml:"payroll_days"`
 }
 
 func (e Employment) Update() Employment {
-	e.Employees.Value += e.Employees.CalcUpdate()
+	e.Employees.Value = max(0, e.Employees.Value+e.Employees.CalcUpdate())
 	e.EmployeeSatisfaction.Value += e.EmployeeSatisfaction.CalcUpdate()
 	e.DailyTurnover.Value += e.DailyTurnover.CalcUpdate()
 	e.HighestAnnualSalary.Value += e.HighestAnnualSalary.CalcUpdate()
@@ -204,18 +580,6 @@ type Assets struct {
 	Investments          bank.CurrencyValue `yaml:"investments"`
 }
 
-func (a Assets) Update() Assets {
-	a.LiquidAssets.Value += a.LiquidAssets.CalcUpdate()
-	a.MarketableSecurities.Value += a.MarketableSecurities.CalcUpdate()
-	a.AccountsReceivables.Value += a.AccountsReceivables.CalcUpdate()
-	a.Inventory.Value += a.Inventory.CalcUpdate()
-	a.PrepaidExpenses.Value += a.PrepaidExpenses.CalcUpdate()
-	a.CapitalAssets.Value += a.CapitalAssets.CalcUpdate()
-	a.IntangibleAssets.Value += a.IntangibleAssets.CalcUpdate()
-	a.Investments.Value += a.Investments.CalcUpdate()
-	return a
-}
-
 type Liabilities struct {
 	AccountsPayable bank.CurrencyValue `yaml:"accounts_payable"`
 	WagesPayable    bank.CurrencyValue `yaml:"wages_payable"`
@@ -226,27 +590,27 @@ type Liabilities struct {
 	LongTermDebts   bank.CurrencyValue `yaml:"long_term_debts"`
 }
 
-func (l Liabilities) Update() Liabilities {
-	l.AccountsPayable.Value += l.AccountsPayable.CalcUpdate()
-	l.WagesPayable.Value += l.WagesPayable.CalcUpdate()
-	l.InterestPayable.Value += l.InterestPayable.CalcUpdate()
-	l.DeferredRevenue.Value += l.DeferredRevenue.CalcUpdate()
-	l.DeferredTaxes.Value += l.DeferredTaxes.CalcUpdate()
-	l.ShortTermDebts.Value += l.ShortTermDebts.CalcUpdate()
-	l.LongTermDebts.Value += l.LongTermDebts.CalcUpdate()
-	return l
+// Equity is opened with the configured retained earnings and treasury stock;
+// share capital is whatever balances the books.
+type Equity struct {
+	ShareCapital     bank.CurrencyValue `yaml:"share_capital"`
+	RetainedEarnings bank.CurrencyValue `yaml:"retained_earnings"`
+	TreasuryStock    bank.CurrencyValue `yaml:"treasury_stock"`
 }
 
 type Income struct {
 	OperatingRevenue       bank.CurrencyValue `yaml:"operating_revenue"`
+	Exports                bank.CurrencyValue `yaml:"exports"`
 	NonOperatingRevenue    bank.CurrencyValue `yaml:"non_operating_revenue"`
 	ProductionExpenses     bank.CurrencyValue `yaml:"production_expenses"`
 	AdministrativeExpenses bank.CurrencyValue `yaml:"administrative_expenses"`
 	Depreciation           bank.CurrencyValue `yaml:"depreciation"`
 }
 
+// Update moves every line by its jitter and drift, except operating revenue,
+// which the industry markets set, and which only drifts.
 func (i Income) Update() Income {
-	i.OperatingRevenue.Value += i.OperatingRevenue.CalcUpdate()
+	i.OperatingRevenue.Value = max(0, i.OperatingRevenue.Value+i.OperatingRevenue.Average)
 	i.NonOperatingRevenue.Value += i.NonOperatingRevenue.CalcUpdate()
 	i.ProductionExpenses.Value += i.ProductionExpenses.CalcUpdate()
 	i.AdministrativeExpenses.Value += i.AdministrativeExpenses.CalcUpdate()
@@ -254,20 +618,31 @@ func (i Income) Update() Income {
 	return i
 }
 
+// QuarterlyBehaviour sets the dividend declared at the end of each quarter,
+// per share. Shareholders are recorded RecordDays after the declaration and
+// paid PaymentDays after that. ShareBuyback is the share of outstanding
+// shares, in basis points, bought back each quarter with cash above the
+// LiquidityFloor; below the floor the company issues shares instead.
 type QuarterlyBehaviour struct {
 	DividendPayout bank.CurrencyValue `yaml:"dividend_payout"`
+	RecordDays     int                `yaml:"record_days"`
+	PaymentDays    int                `yaml:"payment_days"`
 	ShareBuyback   types.Value        `yaml:"share_buyback"`
+	LiquidityFloor bank.CurrencyValue `yaml:"liquidity_floor"`
 }
 
+// Update moves the buyback share by its jitter and drift. The dividend only
+// drifts.
 func (q QuarterlyBehaviour) Update() QuarterlyBehaviour {
-	q.DividendPayout.Value += q.DividendPayout.CalcUpdate()
-	if q.DividendPayout.Value < 0 {
-		q.DividendPayout.Value = 0
-	}
+	q.DividendPayout.Value = max(0, q.DividendPayout.Value+q.DividendPayout.Average)
 	q.ShareBuyback.Value += q.ShareBuyback.CalcUpdate()
 	return q
 }
 
+// QuarterlyMetrics feed the valuation. DividendGrowthRate is how much the
+// dividend per share is expected to grow each quarter and
+// RequiredRateOfReturn is in basis points a year. ProjectedDividends and
+// CurrentStockPrice are worked out from them every day.
 type QuarterlyMetrics struct {
 	DividendGrowthRate   bank.CurrencyValue `yaml:"dividend_growth_rate"`
 	RequiredRateOfReturn types.Value        `yaml:"required_rate_of_return"`
@@ -278,14 +653,26 @@ type QuarterlyMetrics struct {
 func (q QuarterlyMetrics) Update() QuarterlyMetrics {
 	q.DividendGrowthRate.Value += q.DividendGrowthRate.CalcUpdate()
 	q.RequiredRateOfReturn.Value += q.RequiredRateOfReturn.CalcUpdate()
-	q.CurrentStockPrice.Value += q.CurrentStockPrice.CalcUpdate()
-	q.ProjectedDividends.Value += q.ProjectedDividends.CalcUpdate()
 	return q
 }
 
+// Industries lists what a company does. Capacity is the number of units it
+// can sell into each of its primary industries per quarter and MarketShare
+// weighs how much of the demand it wins; it defaults to its capacity.
 type Industries struct {
-	PrimaryIndustries   []Industry `yaml:"primary_industries"`
-	SecondaryIndustries []Industry `yaml:"secondary_industries"`
+	PrimaryIndustries   []Industry       `yaml:"primary_industries"`
+	SecondaryIndustries []Industry       `yaml:"secondary_industries"`
+	Capacity            map[Industry]int `yaml:"capacity"`
+	MarketShare         map[Industry]int `yaml:"market_share"`
+}
+
+func (i Industries) IsPrimary(industry Industry) bool {
+	for _, p := range i.PrimaryIndustries {
+		if p == industry {
+			return true
+		}
+	}
+	return false
 }
 
 type CompanyCycle string
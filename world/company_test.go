@@ -0,0 +1,94 @@
+package world
+
+import (
+	"testing"
+
+	"github.com/jxlxx/GreenIsland/bank"
+	"github.com/jxlxx/GreenIsland/payloads"
+)
+
+func TestCreatePerShare(t *testing.T) {
+	tests := []struct {
+		name     string
+		shares   int
+		postings []posting
+		dividend int
+		expected payloads.PerShare
+	}{
+		{
+			name:   "no shares",
+			shares: 0,
+			postings: []posting{
+				{LiquidAssetsAccount, ShareCapitalAccount, 1000},
+			},
+			expected: payloads.PerShare{CurrencyUnit: bank.Micro},
+		},
+		{
+			name:   "profitable",
+			shares: 100,
+			postings: []posting{
+				{LiquidAssetsAccount, ShareCapitalAccount, 10000},
+				{LiquidAssetsAccount, OperatingRevenueAccount, 500},
+			},
+			dividend: 250,
+			expected: payloads.PerShare{
+				CurrencyUnit:      bank.Micro,
+				OutstandingShares: 100,
+				EPS:               500,
+				BookValue:         10500,
+				PayoutRatio:       5000,
+			},
+		},
+		{
+			name:   "loss making pays out nothing of its earnings",
+			shares: 100,
+			postings: []posting{
+				{LiquidAssetsAccount, ShareCapitalAccount, 10000},
+				{AdministrativeExpensesAccount, LiquidAssetsAccount, 500},
+			},
+			dividend: 250,
+			expected: payloads.PerShare{
+				CurrencyUnit:      bank.Micro,
+				OutstandingShares: 100,
+				EPS:               -500,
+				BookValue:         9500,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &Company{DefaultCurrency: "USD", OutstandingShares: tt.shares, ledger: NewLedger("USD")}
+			c.QuarterlyBehaviour.DividendPayout = bank.CurrencyValue{Currency: "USD", Unit: bank.Micro, Value: tt.dividend}
+			for _, p := range tt.postings {
+				if err := c.ledger.Post(p.debit, p.credit, p.amount, "test"); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if got := c.CreatePerShare(); got != tt.expected {
+				t.Errorf("expected %+v, got %+v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestCreateEquity(t *testing.T) {
+	c := &Company{ledger: NewLedger("USD")}
+	for _, p := range []posting{
+		{LiquidAssetsAccount, ShareCapitalAccount, 10000},
+		{LiquidAssetsAccount, OperatingRevenueAccount, 700},
+		{TreasuryStockAccount, LiquidAssetsAccount, 2000},
+	} {
+		if err := c.ledger.Post(p.debit, p.credit, p.amount, "test"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	before := c.CreateEquity()
+	c.ledger.Close()
+	after := c.CreateEquity()
+	if before.Total != 8700 || after.Total != 8700 {
+		t.Errorf("expected equity of 8700 before and after closing, got %d and %d", before.Total, after.Total)
+	}
+	if after.ShareCapital != 10000 || after.RetainedEarnings != 700 || after.TreasuryStock != 2000 {
+		t.Errorf("got %+v", after)
+	}
+}
@@ -2,13 +2,13 @@ package world
 
 import (
 	"fmt"
+	"sync"
 
 	"github.com/nats-io/nats.go"
 
 	"github.com/jxlxx/GreenIsland/bank"
 	"github.com/jxlxx/GreenIsland/payloads"
 	"github.com/jxlxx/GreenIsland/subjects"
-	"github.com/jxlxx/GreenIsland/types"
 )
 
 type Industry string
@@ -26,24 +26,63 @@ const (
 )
 
 type Country struct {
-	Name            string            `yaml:"name"`
-	Code            string            `yaml:"code"`
-	Currency        bank.CurrencyCode `yaml:"currency_code"`
-	CentralBank     CentralBank       `yaml:"central_bank"`
-	CommercialBanks []*bank.Bank      `yaml:"commercial_banks"`
-	Population      Population        `yaml:"population"`
-
-	nc *nats.EncodedConn
+	Name            string             `yaml:"name"`
+	Code            string             `yaml:"code"`
+	Currency        bank.CurrencyCode  `yaml:"currency_code"`
+	CentralBank     CentralBank        `yaml:"central_bank"`
+	CommercialBanks []*bank.Bank       `yaml:"commercial_banks"`
+	Population      Population         `yaml:"population"`
+	GDP             bank.CurrencyValue `yaml:"gdp"`
+	Treasury        Treasury           `yaml:"treasury"`
+	Trade           Trade              `yaml:"trade"`
+	BusinessCycle   BusinessCycle      `yaml:"business_cycle"`
+
+	mu         sync.Mutex
+	nc         *nats.EncodedConn
+	companies  []*Company
+	households bank.AccountRef
 }
 
-type Population struct {
-	Total   types.Value `yaml:"total"`
-	Working types.Value `yaml:"working"`
+func (c *Country) addCompany(company *Company) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.companies = append(c.companies, company)
 }
 
-type CentralBank struct {
-	Name    string             `yaml:"name"`
-	Reserve bank.CurrencyValue `yaml:"reserve"`
+func (c *Country) removeCompany(company *Company) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	remaining := []*Company{}
+	for _, other := range c.companies {
+		if other != company {
+			remaining = append(remaining, other)
+		}
+	}
+	c.companies = remaining
+}
+
+// headquartered lists the companies based in the country.
+func (c *Country) headquartered() []*Company {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.companies
+}
+
+// gdp is the country's output in minor units.
+func (c *Country) gdp() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return toMinor(c.GDP)
+}
+
+// commercialBank is the country's commercial bank with the given code.
+func (c *Country) commercialBank(code string) (*bank.Bank, error) {
+	for _, b := range c.CommercialBanks {
+		if b.Code == code {
+			return b, nil
+		}
+	}
+	return nil, fmt.Errorf("err: no bank %s in %s", code, c.Code)
 }
 
 func (c *Country) CreateBanks() {
@@ -66,13 +105,22 @@ func (c *Country) DailySubscriber() func(payloads.WorldTick) {
 
 func (c *Country) QuarterlySubscriber() func(payloads.WorldTick) {
 	return func(p payloads.WorldTick) {
-
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		c.advanceCycle(p)
+		if p.Quarter == 1 && p.Quarters() > 0 {
+			c.Population.Age()
+		}
 		update := payloads.QuarterlyCountryUpdate{
 			Name:              c.Name,
 			Quarter:           p.Quarter,
-			TotalPopulation:   c.Population.Total.Value,
-			WorkingPopulation: c.Population.Total.Value,
+			TotalPopulation:   c.Population.Total(),
+			WorkingPopulation: c.Population.Working(),
+			Demographics:      c.Population.report(),
 			MoneySupply:       c.CalculateMoneySupply(),
+			Budget:            c.RunBudget(p),
+			CentralBank:       c.RunCentralBank(p),
+			BusinessCycle:     string(c.BusinessCycle.Phase),
 		}
 
 		if err := c.nc.Publish(subjects.QuarterlyCountryUpdate(c.Code, p.Quarter), update); err != nil {
@@ -82,8 +130,13 @@ func (c *Country) QuarterlySubscriber() func(payloads.WorldTick) {
 }
 
 func (c *Country) DailyUpdate() {
-	c.Population.Total.Value += c.Population.Total.CalcUpdate()
-	c.Population.Working.Value += c.Population.Working.CalcUpdate()
-	c.CentralBank.Reserve.Value += c.CentralBank.Reserve.CalcUpdate()
-
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.Population.Update()
+	c.CentralBank.InterestRate.Value += c.CentralBank.InterestRate.CalcUpdate()
+	for _, b := range c.CommercialBanks {
+		b.SetPolicyRate(c.CentralBank.InterestRate.Value)
+	}
+	c.GDP.Value += c.GDP.CalcUpdate()
+	c.Treasury.Update()
 }
@@ -0,0 +1,81 @@
+package world
+
+import (
+	"fmt"
+	"math/rand"
+
+	"github.com/jxlxx/GreenIsland/payloads"
+	"github.com/jxlxx/GreenIsland/subjects"
+)
+
+// BusinessCycle moves a country through the phases of the cycle as a Markov
+// chain. Transitions are weights out of each phase, evaluated every quarter,
+// and Effects shift the daily average delta of every company headquartered
+// in the country while it is in that phase, in place of the effects of the
+// phase before.
+type BusinessCycle struct {
+	Phase       CompanyCycle                          `yaml:"phase"`
+	Transitions map[CompanyCycle]map[CompanyCycle]int `yaml:"transitions"`
+	Effects     map[CompanyCycle]CycleEffect          `yaml:"effects"`
+}
+
+type CycleEffect struct {
+	Revenue    int `yaml:"revenue"`
+	Employment int `yaml:"employment"`
+	Dividends  int `yaml:"dividends"`
+}
+
+func (b BusinessCycle) next() CompanyCycle {
+	weights := b.Transitions[b.Phase]
+	total := 0
+	for _, w := range weights {
+		total += w
+	}
+	if total <= 0 {
+		return b.Phase
+	}
+	n := rand.Intn(total)
+	for _, phase := range []CompanyCycle{Peak, Recession, Trough, Recovery, Expansion} {
+		if n < weights[phase] {
+			return phase
+		}
+		n -= weights[phase]
+	}
+	return b.Phase
+}
+
+// Outlook is the macro environment a company operates in.
+type Outlook struct {
+	Phase        CompanyCycle
+	Effect       CycleEffect
+	InterestRate int
+}
+
+func (c *Country) outlook() Outlook {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return Outlook{
+		Phase:        c.BusinessCycle.Phase,
+		Effect:       c.BusinessCycle.Effects[c.BusinessCycle.Phase],
+		InterestRate: c.CentralBank.InterestRate.Value,
+	}
+}
+
+// advanceCycle moves the country to its next phase and announces the change.
+func (c *Country) advanceCycle(p payloads.WorldTick) {
+	from := c.BusinessCycle.Phase
+	to := c.BusinessCycle.next()
+	if from == to {
+		return
+	}
+	c.BusinessCycle.Phase = to
+	update := payloads.BusinessCycleUpdate{
+		Country: c.Code,
+		Quarter: p.Quarter,
+		From:    string(from),
+		To:      string(to),
+	}
+	if err := c.nc.Publish(subjects.BusinessCycle(c.Code), update); err != nil {
+		fmt.Println(err)
+	}
+}
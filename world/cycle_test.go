@@ -0,0 +1,111 @@
+package world
+
+import (
+	"testing"
+
+	"github.com/jxlxx/GreenIsland/types"
+)
+
+func TestCycleNext(t *testing.T) {
+	tests := []struct {
+		name        string
+		phase       CompanyCycle
+		transitions map[CompanyCycle]map[CompanyCycle]int
+		expected    []CompanyCycle
+	}{
+		{
+			name:     "no transitions",
+			phase:    Peak,
+			expected: []CompanyCycle{Peak},
+		},
+		{
+			name:        "only weights out of other phases",
+			phase:       Peak,
+			transitions: map[CompanyCycle]map[CompanyCycle]int{Trough: {Recovery: 1}},
+			expected:    []CompanyCycle{Peak},
+		},
+		{
+			name:        "certain transition",
+			phase:       Peak,
+			transitions: map[CompanyCycle]map[CompanyCycle]int{Peak: {Recession: 5}},
+			expected:    []CompanyCycle{Recession},
+		},
+		{
+			name:        "stays or moves on",
+			phase:       Expansion,
+			transitions: map[CompanyCycle]map[CompanyCycle]int{Expansion: {Expansion: 3, Peak: 1, Trough: 0}},
+			expected:    []CompanyCycle{Expansion, Peak},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := BusinessCycle{Phase: tt.phase, Transitions: tt.transitions}
+			for i := 0; i < 100; i++ {
+				got := b.next()
+				ok := false
+				for _, phase := range tt.expected {
+					ok = ok || got == phase
+				}
+				if !ok {
+					t.Fatalf("expected one of %v, got %s", tt.expected, got)
+				}
+			}
+		})
+	}
+}
+
+func TestApplyCycle(t *testing.T) {
+	expansion := CycleEffect{Revenue: 3, Employment: 2, Dividends: 1}
+	recession := CycleEffect{Revenue: -5, Employment: -4, Dividends: -1}
+	tests := []struct {
+		name     string
+		phases   []CycleEffect
+		drift    int
+		expected CycleEffect
+	}{
+		{"no phase", nil, 1, CycleEffect{Revenue: 0, Employment: 1, Dividends: 0}},
+		{"one phase", []CycleEffect{expansion}, 1, CycleEffect{Revenue: 3, Employment: 3, Dividends: 1}},
+		{"applied once a phase", []CycleEffect{expansion, expansion, expansion}, 1, CycleEffect{Revenue: 3, Employment: 3, Dividends: 1}},
+		{"replaced by the next phase", []CycleEffect{expansion, recession}, 1, CycleEffect{Revenue: -5, Employment: -3, Dividends: -1}},
+		{"back to neutral", []CycleEffect{recession, {}}, 1, CycleEffect{Revenue: 0, Employment: 1, Dividends: 0}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &Company{}
+			c.Employment.Employees.Average = tt.drift
+			for _, effect := range tt.phases {
+				c.applyCycle(effect)
+			}
+			got := CycleEffect{
+				Revenue:    c.Income.OperatingRevenue.Average,
+				Employment: c.Employment.Employees.Average,
+				Dividends:  c.QuarterlyBehaviour.DividendPayout.Average,
+			}
+			if got != tt.expected {
+				t.Errorf("expected drifts %+v, got %+v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestDriftFloorsAtZero(t *testing.T) {
+	c := &Company{}
+	c.Employment.Employees = types.Value{Value: 10, Jitter: 1}
+	c.Income.OperatingRevenue = money("USD", 10)
+	c.QuarterlyBehaviour.DividendPayout = money("USD", 10)
+	c.applyCycle(CycleEffect{Revenue: -4, Employment: -4, Dividends: -4})
+	for day := 0; day < 10; day++ {
+		c.Income = c.Income.Update()
+		c.QuarterlyBehaviour = c.QuarterlyBehaviour.Update()
+		c.Employment = c.Employment.Update()
+	}
+	if v := c.Employment.Employees.Value; v != 0 {
+		t.Errorf("expected no employees left, got %d", v)
+	}
+	if v := c.Income.OperatingRevenue.Value; v != 0 {
+		t.Errorf("expected no revenue left, got %d", v)
+	}
+	if v := c.QuarterlyBehaviour.DividendPayout.Value; v != 0 {
+		t.Errorf("expected no dividend left, got %d", v)
+	}
+}
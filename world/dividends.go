@@ -0,0 +1,166 @@
+package world
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/google/uuid"
+
+	"github.com/jxlxx/GreenIsland/bank"
+	"github.com/jxlxx/GreenIsland/broker"
+	"github.com/jxlxx/GreenIsland/payloads"
+	"github.com/jxlxx/GreenIsland/subjects"
+)
+
+// dividend is declared at the end of a quarter. Shareholders are taken from
+// the broker on the record day and paid on the payment day.
+type dividend struct {
+	quarter  int
+	perShare int
+	declared int
+	record   int
+	payment  int
+	holders  map[uuid.UUID]int
+}
+
+// seedShareholders gives the company's outstanding shares to its founder, or
+// to the households of its home country the first time the world runs.
+func (c *Company) seedShareholders() {
+	if c.broker == nil || c.country == nil {
+		return
+	}
+	holders, err := c.broker.Holders(c.Code)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	if len(holders) > 0 {
+		return
+	}
+	holder := c.country.households
+	if c.founder.AccountID != uuid.Nil {
+		holder = c.founder
+	}
+	if err := c.broker.SetSettlement(holder.AccountID, holder); err != nil {
+		log.Println(err)
+		return
+	}
+	if err := c.broker.Put(holder.AccountID, c.Code, broker.Available, c.OutstandingShares); err != nil {
+		log.Println(err)
+	}
+}
+
+// declareDividend books the quarter's payout as owed to shareholders. The
+// caller holds c.mu.
+func (c *Company) declareDividend(p payloads.WorldTick) {
+	if c.dividend != nil {
+		log.Println(c.Code, "err: previous dividend has not been paid")
+		return
+	}
+	perShare := toMicro(c.QuarterlyBehaviour.DividendPayout)
+	total := c.dividendAmount(perShare, c.OutstandingShares)
+	if total <= 0 {
+		return
+	}
+	today := p.Days()
+	c.dividend = &dividend{
+		quarter:  p.Quarter,
+		perShare: perShare,
+		declared: total,
+		record:   today + c.QuarterlyBehaviour.RecordDays,
+		payment:  today + c.QuarterlyBehaviour.RecordDays + c.QuarterlyBehaviour.PaymentDays,
+	}
+	c.book(RetainedEarningsAccount, DividendsPayableAccount, total, "dividend declared")
+	c.publishDividend(c.dividend, "declared", payloads.DividendUpdate{})
+}
+
+// dividendAmount is what a holding earns, in minor units.
+func (c *Company) dividendAmount(perShare, shares int) int {
+	sum, err := bank.Convert(c.DefaultCurrency, bank.Micro, bank.Minor, perShare*shares)
+	if err != nil {
+		log.Println(err)
+		return 0
+	}
+	return sum
+}
+
+// dividendDay records shareholders on the record day and pays them on the
+// payment day. Treasury shares are not on the record. The caller holds c.mu.
+func (c *Company) dividendDay(day int) {
+	d := c.dividend
+	if d == nil {
+		return
+	}
+	if day >= d.record && d.holders == nil {
+		holders, err := c.broker.Holders(c.Code)
+		if err != nil {
+			log.Println(c.Code, err)
+			return
+		}
+		delete(holders, c.id)
+		d.holders = holders
+	}
+	if day >= d.payment && d.holders != nil {
+		c.payDividend()
+	}
+}
+
+// payDividend pays every shareholder of record. Anything that cannot be paid
+// goes back to retained earnings and is reported. The caller holds c.mu,
+// which is let go while the shareholders are paid.
+func (c *Company) payDividend() {
+	d := c.dividend
+	c.dividend = nil
+	update := payloads.DividendUpdate{Shareholders: len(d.holders)}
+	amounts := map[uuid.UUID]int{}
+	for holder, shares := range d.holders {
+		if amount := c.dividendAmount(d.perShare, shares); amount > 0 {
+			amounts[holder] = amount
+		}
+	}
+	errs := map[uuid.UUID]error{}
+	c.unlocked(func() {
+		for holder, amount := range amounts {
+			errs[holder] = c.payShareholder(holder, amount)
+		}
+	})
+	for holder, amount := range amounts {
+		if err := errs[holder]; err != nil {
+			update.Failures = append(update.Failures, payloads.DividendFailure{
+				Holder: holder,
+				Amount: amount,
+				Error:  err.Error(),
+			})
+			continue
+		}
+		c.book(DividendsPayableAccount, LiquidAssetsAccount, amount, "dividend paid")
+		update.Paid += amount
+	}
+	c.book(DividendsPayableAccount, RetainedEarningsAccount, d.declared-update.Paid, "dividend unpaid")
+	c.BalanceSheet.sync(c.ledger)
+	c.publishDividend(d, "paid", update)
+}
+
+func (c *Company) payShareholder(holder uuid.UUID, amount int) error {
+	account, err := c.broker.Settlement(holder)
+	if err != nil {
+		return fmt.Errorf("no settlement account: %w", err)
+	}
+	return pay(c.nc, c.account, account, money(c.DefaultCurrency, amount))
+}
+
+func (c *Company) publishDividend(d *dividend, status string, update payloads.DividendUpdate) {
+	update.Company = c.Code
+	update.Status = status
+	update.Quarter = d.quarter
+	update.CurrencyCode = c.DefaultCurrency
+	update.CurrencyUnit = bank.Minor
+	update.PerShareUnit = bank.Micro
+	update.PerShare = d.perShare
+	update.Declared = d.declared
+	update.RecordDay = d.record
+	update.PaymentDay = d.payment
+	if err := c.nc.Publish(subjects.Dividend(c.Code), update); err != nil {
+		fmt.Println(err)
+	}
+}
@@ -0,0 +1,26 @@
+package world
+
+import "testing"
+
+func TestDividendAmount(t *testing.T) {
+	tests := []struct {
+		name     string
+		perShare int
+		shares   int
+		expected int
+	}{
+		{"whole cents", 10000, 50, 5000},
+		{"fractions of a cent add up", 150, 1000, 1500},
+		{"rounded down", 150, 1, 1},
+		{"too small to pay", 50, 1, 0},
+		{"no shares", 10000, 0, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &Company{DefaultCurrency: "USD"}
+			if got := c.dividendAmount(tt.perShare, tt.shares); got != tt.expected {
+				t.Errorf("expected %d, got %d", tt.expected, got)
+			}
+		})
+	}
+}
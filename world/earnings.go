@@ -0,0 +1,158 @@
+package world
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+
+	"github.com/jxlxx/GreenIsland/payloads"
+	"github.com/jxlxx/GreenIsland/subjects"
+)
+
+// Earnings sets when a company reports and how its results move its quote.
+// A quarter's results are published ReportDays into the next quarter; zero
+// publishes them as soon as the books close. After each report, analysts
+// each estimate the next quarter's revenue and earnings per share halfway
+// between the run rate and the results just reported, off by up to
+// Dispersion basis points. Every percent the earnings per share
+// beat or miss their consensus moves the fair value by Sensitivity basis
+// points of a percent until the next report.
+type Earnings struct {
+	ReportDays  int `yaml:"report_days"`
+	Analysts    int `yaml:"analysts"`
+	Dispersion  int `yaml:"dispersion"`
+	Sensitivity int `yaml:"sensitivity"`
+}
+
+// consensus is the analysts' average estimate for a quarter, revenue in
+// minor units and earnings per share in micro units.
+type consensus struct {
+	analysts int
+	revenue  int
+	eps      int
+}
+
+// earningsReport is a quarter's results waiting for their report day.
+type earningsReport struct {
+	day       int
+	consensus *consensus
+	update    payloads.QuarterlyCompanyUpdate
+}
+
+// forecast takes the analysts' consensus for the coming quarter, given the
+// last results if there are any. The caller holds c.mu.
+func (c *Company) forecast(last *payloads.QuarterlyCompanyUpdate) *consensus {
+	analysts := max(1, c.Earnings.Analysts)
+	abroad, _ := c.subsidiaryRunRate()
+	revenue := toMinor(c.Income.OperatingRevenue) + c.supplies + abroad
+	eps := c.runRateEPS()
+	if last != nil && last.IncomeSheet.OperatingRevenue != 0 {
+		revenue = (revenue + last.IncomeSheet.OperatingRevenue) / 2
+		eps = (eps + float64(last.PerShare.EPS)) / 2
+	}
+	f := &consensus{analysts: analysts}
+	for i := 0; i < analysts; i++ {
+		f.revenue += proportion(revenue, 10000+c.estimateError(), 10000)
+		f.eps += int(math.Round(eps * float64(10000+c.estimateError()) / 10000))
+	}
+	f.revenue /= analysts
+	f.eps /= analysts
+	return f
+}
+
+func (c *Company) estimateError() int {
+	d := c.Earnings.Dispersion
+	if d <= 0 {
+		return 0
+	}
+	return rand.Intn(2*d+1) - d
+}
+
+// scheduleEarnings holds back the quarter's results until the report day
+// and announces the date with the consensus for them. The caller holds c.mu.
+func (c *Company) scheduleEarnings(update payloads.QuarterlyCompanyUpdate, day int) {
+	report := &earningsReport{
+		day:       day + min(c.Earnings.ReportDays, daysPerQuarter-1),
+		consensus: c.consensus,
+		update:    update,
+	}
+	if c.Earnings.ReportDays <= 0 {
+		c.reportEarnings(report)
+		return
+	}
+	c.earnings = report
+	date := payloads.EarningsDate{
+		Company:      c.Code,
+		Quarter:      update.Quarter,
+		ReportDay:    report.day,
+		CurrencyCode: c.DefaultCurrency,
+	}
+	if f := report.consensus; f != nil {
+		date.Analysts = f.analysts
+		date.RevenueConsensus = f.revenue
+		date.EPSConsensus = f.eps
+	}
+	if err := c.nc.Publish(subjects.EarningsDate(c.Code), date); err != nil {
+		fmt.Println(err)
+	}
+}
+
+// earningsDay publishes the results that are due. The caller holds c.mu.
+func (c *Company) earningsDay(day int) {
+	if c.earnings == nil || day < c.earnings.day {
+		return
+	}
+	report := c.earnings
+	c.earnings = nil
+	c.reportEarnings(report)
+}
+
+// reportEarnings publishes a quarter's results against the consensus and
+// reprices the company on the surprise. Analysts then turn to the next
+// quarter. The caller holds c.mu.
+func (c *Company) reportEarnings(report *earningsReport) {
+	update := report.update
+	if f := report.consensus; f != nil {
+		e := payloads.Earnings{
+			ReportDay:        report.day,
+			Analysts:         f.analysts,
+			RevenueConsensus: f.revenue,
+			Revenue:          update.IncomeSheet.OperatingRevenue,
+			RevenueSurprise:  surprise(update.IncomeSheet.OperatingRevenue, f.revenue),
+			EPSConsensus:     f.eps,
+			EPS:              update.PerShare.EPS,
+			EPSSurprise:      surprise(update.PerShare.EPS, f.eps),
+		}
+		update.Earnings = e
+		c.surprise = proportion(e.EPSSurprise, c.Earnings.Sensitivity, 10000)
+		c.Bid, c.Ask = c.UpdateBidAsk()
+		update.Quote = c.CreateQuote()
+		update.Ratios = CreateRatios(update)
+	}
+	if err := c.nc.Publish(subjects.QuarterlyCompanyUpdate(c.Code, update.Quarter), update); err != nil {
+		fmt.Println(err)
+	}
+	c.consensus = c.forecast(&update)
+}
+
+// surprise is how far the actual figure beat the estimate, in basis points
+// of the estimate, capped at twice it either way.
+func surprise(actual, estimate int) int {
+	if estimate == 0 {
+		return 0
+	}
+	s := proportion(actual-estimate, 10000, abs(estimate))
+	return max(-20000, min(20000, s))
+}
+
+// surprisePremium adjusts a value for the last earnings surprise.
+func (c *Company) surprisePremium(v float64) float64 {
+	return v * float64(max(0, 10000+c.surprise)) / 10000
+}
+
+func abs(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
@@ -0,0 +1,28 @@
+package world
+
+import "testing"
+
+func TestSurprise(t *testing.T) {
+	tests := []struct {
+		name     string
+		actual   int
+		estimate int
+		expected int
+	}{
+		{"in line", 100, 100, 0},
+		{"beat", 110, 100, 1000},
+		{"miss", 90, 100, -1000},
+		{"no estimate", 100, 0, 0},
+		{"beat capped", 500, 100, 20000},
+		{"miss capped", -300, 100, -20000},
+		{"smaller loss than expected", -50, -100, 5000},
+		{"bigger loss than expected", -150, -100, -5000},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := surprise(tt.actual, tt.estimate); got != tt.expected {
+				t.Errorf("expected %d, got %d", tt.expected, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,258 @@
+package world
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"unicode"
+
+	"github.com/google/uuid"
+	"github.com/nats-io/nats.go/micro"
+
+	"github.com/jxlxx/GreenIsland/bank"
+	"github.com/jxlxx/GreenIsland/config"
+	"github.com/jxlxx/GreenIsland/payloads"
+	"github.com/jxlxx/GreenIsland/subjects"
+)
+
+const startupTemplate = "/data/companies/startup.yaml"
+
+// Founding is how the engine starts companies in a market. At the end of a
+// quarter in which the market's producers earned an average operating margin
+// of at least Margin basis points, a startup with Capital is founded in the
+// home country of the most profitable of them, unless a private one is
+// already waiting to list. A zero Margin never founds.
+type Founding struct {
+	Margin  int                `yaml:"margin"`
+	Capital bank.CurrencyValue `yaml:"capital"`
+}
+
+// startup fills in the company template. Only values the engine has checked
+// go into it; names and the code are set on the company afterwards.
+type startup struct {
+	CountryCode string
+	Industry    Industry
+	Capital     int
+	Currency    bank.CurrencyCode
+	BankCode    string
+}
+
+// margin is the company's operating margin in an industry, in basis points,
+// and whether it is still private. It is false if the company does not
+// operate primarily in the industry.
+func (c *Company) margin(industry Industry) (int, bool, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed || !c.Industries.IsPrimary(industry) {
+		return 0, false, false
+	}
+	revenue := toMinor(c.Income.OperatingRevenue)
+	if revenue <= 0 {
+		return 0, c.Private, true
+	}
+	return proportion(c.runRateEarnings(), 10000, revenue), c.Private, true
+}
+
+// FoundingSubscriber lists the private companies that are ready to go public
+// and founds startups in the markets that are worth entering.
+func (w *World) FoundingSubscriber() func(payloads.WorldTick) {
+	return func(p payloads.WorldTick) {
+		w.mu.Lock()
+		companies, markets := w.companies, w.markets
+		w.mu.Unlock()
+		for _, c := range companies {
+			if c.readyToList() {
+				w.goPublic(c, p)
+			}
+		}
+		for _, m := range markets {
+			w.foundStartup(m, companies, p)
+		}
+	}
+}
+
+func (w *World) foundStartup(m *Market, companies []*Company, p payloads.WorldTick) {
+	if m.Founding.Margin <= 0 {
+		return
+	}
+	var best *Company
+	bestMargin, sum, producers := 0, 0, 0
+	for _, c := range companies {
+		margin, private, ok := c.margin(m.Industry)
+		if !ok {
+			continue
+		}
+		if private {
+			return
+		}
+		sum += margin
+		producers++
+		if best == nil || margin > bestMargin {
+			best, bestMargin = c, margin
+		}
+	}
+	if producers == 0 || sum/producers < m.Founding.Margin || best.country == nil {
+		return
+	}
+	country := best.country
+	capital, err := w.fx.Convert(m.Founding.Capital, country.Currency, p.EGT)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	industry := string(m.Industry)
+	title := strings.ToUpper(industry[:1]) + strings.ReplaceAll(industry[1:], "_", " ")
+	code := fmt.Sprintf("%.3s%d", strings.ToUpper(industry), p.Quarters())
+	f := payloads.CompanyFounding{
+		Name:        fmt.Sprintf("%s %s %s", country.Code, title, code),
+		FullName:    fmt.Sprintf("%s %s Ventures %s", country.Name, title, code),
+		Code:        code,
+		CountryCode: country.Code,
+		Industry:    industry,
+		Capital:     toMinor(capital),
+	}
+	if err := w.found(f); err != nil {
+		log.Println(err)
+	}
+}
+
+// found starts a private company from the startup template. Its founder pays
+// in its capital and holds all of its shares; the households of its country
+// found it unless someone else does. Companies are founded one at a time so
+// that no two get the same code.
+func (w *World) found(f payloads.CompanyFounding) error {
+	if f.Code == "" || strings.IndexFunc(f.Code, func(r rune) bool { return !unicode.IsLetter(r) && !unicode.IsDigit(r) }) >= 0 {
+		return fmt.Errorf("err: a company code is letters and digits, not %q", f.Code)
+	}
+	w.foundMu.Lock()
+	defer w.foundMu.Unlock()
+	w.mu.Lock()
+	var country *Country
+	for _, c := range w.countries {
+		if c.Code == f.CountryCode {
+			country = c
+		}
+	}
+	known := false
+	for _, m := range w.markets {
+		if string(m.Industry) == f.Industry {
+			known = true
+		}
+	}
+	for _, c := range w.companies {
+		if c.Code == f.Code {
+			w.mu.Unlock()
+			return fmt.Errorf("err: company %s already exists", f.Code)
+		}
+	}
+	w.mu.Unlock()
+	if country == nil || len(country.CommercialBanks) == 0 {
+		return fmt.Errorf("err: cannot found a company in %s", f.CountryCode)
+	}
+	if !known {
+		return fmt.Errorf("err: no %s market", f.Industry)
+	}
+
+	c := &Company{}
+	data := startup{
+		CountryCode: country.Code,
+		Industry:    Industry(f.Industry),
+		Capital:     f.Capital,
+		Currency:    country.Currency,
+		BankCode:    country.CommercialBanks[0].Code,
+	}
+	if err := config.ReadTemplate(startupTemplate, data, c); err != nil {
+		return err
+	}
+	c.Code = f.Code
+	c.Name = f.Name
+	c.FullName = f.FullName
+	prepareCompany(c)
+	c.country = country
+	c.broker = w.broker
+	c.fx = w.fx
+	c.onClose = w.liquidated
+	c.households = w.households
+	c.founder = f.Founder
+	if c.founder.AccountID == uuid.Nil {
+		c.founder = country.households
+	}
+	if err := c.InitializeCompany(); err != nil {
+		return err
+	}
+
+	country.addCompany(c)
+	w.mu.Lock()
+	w.companies = append(w.companies, c)
+	w.mu.Unlock()
+	w.subscribeCompany(c)
+
+	f.Founder = c.founder
+	if err := w.nc.Publish(subjects.Founded(c.Code), f); err != nil {
+		fmt.Println(err)
+	}
+	return nil
+}
+
+// FoundCompany founds a company on an admin's request.
+func (w *World) FoundCompany(req micro.Request) {
+	f := payloads.CompanyFounding{}
+	if err := json.Unmarshal(req.Data(), &f); err != nil {
+		respondError(req, "cannot parse request")
+		return
+	}
+	if f.Code == "" || f.Industry == "" || f.Capital <= 0 {
+		respondError(req, "a company needs a code, an industry and capital")
+		return
+	}
+	if f.Name == "" {
+		f.Name = f.Code
+	}
+	if f.FullName == "" {
+		f.FullName = f.Name
+	}
+	if err := w.found(f); err != nil {
+		respondError(req, err.Error())
+		return
+	}
+	if err := req.RespondJSON(bank.Response{Status: "OK"}); err != nil {
+		log.Println(err)
+	}
+}
+
+// ListCompany asks a private company to go public at the end of the quarter.
+func (w *World) ListCompany(req micro.Request) {
+	r := payloads.IPORequest{}
+	if err := json.Unmarshal(req.Data(), &r); err != nil {
+		respondError(req, "cannot parse request")
+		return
+	}
+	w.mu.Lock()
+	companies := w.companies
+	w.mu.Unlock()
+	for _, c := range companies {
+		if c.Code != r.Code {
+			continue
+		}
+		if err := c.requestListing(); err != nil {
+			respondError(req, err.Error())
+			return
+		}
+		if err := req.RespondJSON(bank.Response{Status: "OK"}); err != nil {
+			log.Println(err)
+		}
+		return
+	}
+	respondError(req, fmt.Sprintf("no company %s", r.Code))
+}
+
+func (c *Company) requestListing() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.Private {
+		return fmt.Errorf("%s is already public", c.Code)
+	}
+	c.listing = true
+	return nil
+}
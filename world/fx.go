@@ -0,0 +1,255 @@
+package world
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"math/rand"
+	"sort"
+	"sync"
+
+	"github.com/nats-io/nats.go/micro"
+
+	"github.com/jxlxx/GreenIsland/bank"
+	"github.com/jxlxx/GreenIsland/config"
+	"github.com/jxlxx/GreenIsland/payloads"
+	"github.com/jxlxx/GreenIsland/subjects"
+)
+
+const hoursPerYear = 24 * 90 * 4
+
+// FXMarket floats every currency against every other. Rates are quoted as
+// major units of a currency per major unit of Base. Each hour a currency
+// drifts with its interest rate relative to the others and with its
+// country's trade balance, plus a random shock.
+type FXMarket struct {
+	Base          bank.CurrencyCode             `yaml:"base"`
+	Rates         map[bank.CurrencyCode]float64 `yaml:"rates"`
+	InterestRates map[bank.CurrencyCode]int     `yaml:"interest_rates"`
+	Volatility    float64                       `yaml:"volatility"`
+	RateWeight    float64                       `yaml:"rate_weight"`
+	TradeWeight   float64                       `yaml:"trade_weight"`
+	HistoryHours  int                           `yaml:"history_hours"`
+
+	mu           sync.RWMutex
+	values       map[bank.CurrencyCode]float64
+	history      map[int]map[bank.CurrencyCode]float64
+	hours        []int
+	tradeBalance map[bank.CurrencyCode]float64
+}
+
+func createFXMarket() *FXMarket {
+	fx := &FXMarket{}
+	config.ReadConfig("/data/fx.yaml", fx)
+	fx.values = map[bank.CurrencyCode]float64{}
+	for code, rate := range fx.Rates {
+		fx.values[code] = 1 / rate
+	}
+	fx.history = map[int]map[bank.CurrencyCode]float64{0: fx.snapshot()}
+	fx.hours = []int{0}
+	fx.tradeBalance = map[bank.CurrencyCode]float64{}
+	return fx
+}
+
+func (fx *FXMarket) snapshot() map[bank.CurrencyCode]float64 {
+	values := map[bank.CurrencyCode]float64{}
+	for code, v := range fx.values {
+		values[code] = v
+	}
+	return values
+}
+
+func (fx *FXMarket) Currencies() []bank.CurrencyCode {
+	fx.mu.RLock()
+	defer fx.mu.RUnlock()
+	codes := []bank.CurrencyCode{}
+	for code := range fx.values {
+		codes = append(codes, code)
+	}
+	return codes
+}
+
+// Rate is the number of major units of quote one major unit of base buys at
+// the given game hour, with the hour the rate was set. A rate holds until the
+// next one is set; an hour older than the history kept gets the oldest rate.
+func (fx *FXMarket) Rate(base, quote bank.CurrencyCode, hour int) (float64, int, error) {
+	fx.mu.RLock()
+	defer fx.mu.RUnlock()
+	set := fx.rateHour(hour)
+	values := fx.history[set]
+	b, ok := values[base]
+	if !ok {
+		return 0, 0, fmt.Errorf("err: no exchange rate for %s", base)
+	}
+	q, ok := values[quote]
+	if !ok {
+		return 0, 0, fmt.Errorf("err: no exchange rate for %s", quote)
+	}
+	return b / q, set, nil
+}
+
+// rateHour is the hour the rates in force at an hour were set. The caller
+// holds fx.mu.
+func (fx *FXMarket) rateHour(hour int) int {
+	i := sort.SearchInts(fx.hours, hour+1) - 1
+	return fx.hours[max(0, i)]
+}
+
+// Convert expresses v in another currency, keeping its unit.
+func (fx *FXMarket) Convert(v bank.CurrencyValue, to bank.CurrencyCode, hour int) (bank.CurrencyValue, error) {
+	if v.Currency == to {
+		return v, nil
+	}
+	rate, _, err := fx.Rate(v.Currency, to, hour)
+	if err != nil {
+		return bank.CurrencyValue{}, err
+	}
+	return convertAt(v, to, rate)
+}
+
+// convertAt expresses v in another currency at the given rate.
+func convertAt(v bank.CurrencyValue, to bank.CurrencyCode, rate float64) (bank.CurrencyValue, error) {
+	from, err := majorPerUnit(v.Currency, v.Unit)
+	if err != nil {
+		return bank.CurrencyValue{}, err
+	}
+	into, err := majorPerUnit(to, v.Unit)
+	if err != nil {
+		return bank.CurrencyValue{}, err
+	}
+	converted := float64(v.Value) * from * rate / into
+	return bank.CurrencyValue{
+		Currency: to,
+		Unit:     v.Unit,
+		Value:    int(math.Round(converted)),
+	}, nil
+}
+
+// majorPerUnit is how many major units one unit of a currency is worth.
+func majorPerUnit(code bank.CurrencyCode, unit bank.UnitType) (float64, error) {
+	major, err := bank.Convert(code, bank.Major, bank.Minor, 1)
+	if err != nil {
+		return 0, err
+	}
+	if unit == bank.Micro {
+		micro, err := bank.Convert(code, bank.Minor, bank.Micro, 1)
+		if err != nil {
+			return 0, err
+		}
+		return 1 / float64(micro) / float64(major), nil
+	}
+	minor, err := bank.Convert(code, unit, bank.Minor, 1)
+	if err != nil {
+		return 0, err
+	}
+	return float64(minor) / float64(major), nil
+}
+
+// SetTradeBalance records a currency's latest trade balance as a share of
+// its country's output.
+func (fx *FXMarket) SetTradeBalance(code bank.CurrencyCode, share float64) {
+	fx.mu.Lock()
+	defer fx.mu.Unlock()
+	fx.tradeBalance[code] = share
+}
+
+func (fx *FXMarket) update(hour int, interestRates map[bank.CurrencyCode]int) {
+	fx.mu.Lock()
+	defer fx.mu.Unlock()
+
+	rates := map[bank.CurrencyCode]int{}
+	for code := range fx.values {
+		rates[code] = fx.InterestRates[code]
+		if r, ok := interestRates[code]; ok {
+			rates[code] = r
+		}
+	}
+	average := 0.0
+	for _, r := range rates {
+		average += float64(r)
+	}
+	average /= float64(len(rates))
+
+	for code, v := range fx.values {
+		differential := (float64(rates[code]) - average) / 10000
+		drift := (fx.RateWeight*differential + fx.TradeWeight*fx.tradeBalance[code]) / hoursPerYear
+		shock := fx.Volatility * rand.NormFloat64()
+		fx.values[code] = v * math.Exp(drift+shock)
+	}
+
+	fx.history[hour] = fx.snapshot()
+	fx.hours = append(fx.hours, hour)
+	for len(fx.hours) > 1 && fx.hours[0] <= hour-fx.HistoryHours {
+		delete(fx.history, fx.hours[0])
+		fx.hours = fx.hours[1:]
+	}
+}
+
+func (w *World) FXSubscriber() func(payloads.WorldTick) {
+	return func(p payloads.WorldTick) {
+		interestRates := map[bank.CurrencyCode]int{}
+		for _, c := range w.countries {
+			interestRates[c.Currency] = c.interestRate()
+		}
+		w.fx.update(p.EGT, interestRates)
+
+		codes := w.fx.Currencies()
+		for _, base := range codes {
+			for _, quote := range codes {
+				if base == quote {
+					continue
+				}
+				rate, _, err := w.fx.Rate(base, quote, p.EGT)
+				if err != nil {
+					log.Println(err)
+					continue
+				}
+				msg := payloads.FXRate{
+					Base:  base,
+					Quote: quote,
+					Rate:  rate,
+					EGT:   p.EGT,
+				}
+				if err := w.nc.Publish(subjects.FXRate(string(base), string(quote)), msg); err != nil {
+					fmt.Println(err)
+				}
+			}
+		}
+	}
+}
+
+func (w *World) Quote(req micro.Request) {
+	r := payloads.FXQuoteRequest{}
+	if err := json.Unmarshal(req.Data(), &r); err != nil {
+		respondError(req, "cannot parse request")
+		return
+	}
+	v := bank.CurrencyValue{
+		Currency: r.From,
+		Unit:     r.Unit,
+		Value:    r.Amount,
+	}
+	rate, hour, err := w.fx.Rate(r.From, r.To, r.EGT)
+	if err != nil {
+		respondError(req, err.Error())
+		return
+	}
+	converted, err := convertAt(v, r.To, rate)
+	if err != nil {
+		respondError(req, err.Error())
+		return
+	}
+	quote := payloads.FXQuote{
+		From:      r.From,
+		To:        r.To,
+		Unit:      r.Unit,
+		Amount:    r.Amount,
+		Converted: converted.Value,
+		Rate:      rate,
+		EGT:       hour,
+	}
+	if err := req.RespondJSON(quote); err != nil {
+		log.Println(err)
+	}
+}
@@ -0,0 +1,69 @@
+package world
+
+import (
+	"testing"
+
+	"github.com/jxlxx/GreenIsland/bank"
+)
+
+func TestRateHistory(t *testing.T) {
+	fx := &FXMarket{
+		history: map[int]map[bank.CurrencyCode]float64{
+			0:  {"USD": 1, "CAD": 0.8},
+			10: {"USD": 1, "CAD": 0.5},
+		},
+		hours: []int{0, 10},
+	}
+	tests := []struct {
+		name string
+		hour int
+		rate float64
+		set  int
+	}{
+		{"opening rate", 0, 1.25, 0},
+		{"held until the next one", 9, 1.25, 0},
+		{"set on the hour", 10, 2, 10},
+		{"latest rate", 50, 2, 10},
+		{"before the history", -5, 1.25, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rate, set, err := fx.Rate("USD", "CAD", tt.hour)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if rate != tt.rate || set != tt.set {
+				t.Errorf("expected %v set at %d, got %v set at %d", tt.rate, tt.set, rate, set)
+			}
+		})
+	}
+	if _, _, err := fx.Rate("USD", "XXX", 0); err == nil {
+		t.Error("expected an error for an unknown currency")
+	}
+}
+
+func TestConvertAt(t *testing.T) {
+	tests := []struct {
+		name     string
+		v        bank.CurrencyValue
+		to       bank.CurrencyCode
+		rate     float64
+		expected int
+	}{
+		{"minor units", money("USD", 10000), "CAD", 1.35, 13500},
+		{"rounded", money("USD", 1), "CAD", 1.35, 1},
+		{"major units", bank.CurrencyValue{Currency: "USD", Unit: bank.Major, Value: 100}, "CAD", 0.5, 50},
+		{"micro units", bank.CurrencyValue{Currency: "USD", Unit: bank.Micro, Value: 1000}, "CAD", 2, 2000},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := convertAt(tt.v, tt.to, tt.rate)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.Currency != tt.to || got.Unit != tt.v.Unit || got.Value != tt.expected {
+				t.Errorf("expected %d %s %s, got %+v", tt.expected, tt.v.Unit, tt.to, got)
+			}
+		})
+	}
+}
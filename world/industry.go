@@ -0,0 +1,173 @@
+package world
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/jxlxx/GreenIsland/bank"
+	"github.com/jxlxx/GreenIsland/config"
+	"github.com/jxlxx/GreenIsland/payloads"
+	"github.com/jxlxx/GreenIsland/subjects"
+	"github.com/jxlxx/GreenIsland/types"
+)
+
+// Market is the global market for one industry. Demand is in units per
+// quarter and Price is per unit. Capacity is what the companies operating
+// primarily in the industry can produce between them. Every quarter the price
+// moves by Sensitivity basis points for each percent demand exceeds capacity,
+// by no more than MaxMove basis points, and stays within PriceRange times its
+// opening price either way.
+type Market struct {
+	Industry    Industry           `yaml:"industry"`
+	Demand      types.Value        `yaml:"demand"`
+	Price       bank.CurrencyValue `yaml:"price"`
+	Sensitivity int                `yaml:"sensitivity"`
+	MaxMove     int                `yaml:"max_move"`
+	PriceRange  int                `yaml:"price_range"`
+	Founding    Founding           `yaml:"founding"`
+	Supply      Supply             `yaml:"supply"`
+
+	opening int
+}
+
+func createMarkets() []*Market {
+	conf := struct {
+		Markets []*Market `yaml:"markets"`
+	}{}
+	config.ReadConfig("/data/industries.yaml", &conf)
+	for _, m := range conf.Markets {
+		m.opening = m.Price.Value
+	}
+	return conf.Markets
+}
+
+// reprice moves the price by how far demand outran or fell short of capacity
+// over the quarter.
+func (m *Market) reprice(demand, capacity int) {
+	if capacity == 0 {
+		return
+	}
+	excess := float64(demand-capacity) / float64(capacity) * 100
+	move := excess * float64(m.Sensitivity)
+	if m.MaxMove > 0 {
+		move = min(float64(m.MaxMove), max(-float64(m.MaxMove), move))
+	}
+	price := m.Price.Value + int(float64(m.Price.Value)*move/10000)
+	if m.PriceRange > 0 && m.opening > 0 {
+		price = min(m.opening*m.PriceRange, max(m.opening/m.PriceRange, price))
+	}
+	m.Price.Value = max(1, price)
+}
+
+// producers lists the companies selling into the market with their capacity.
+func (w *World) producers(m *Market) map[*Company]int {
+	capacity := map[*Company]int{}
+	for _, c := range w.companies {
+		if units := c.capacity(m.Industry); units > 0 {
+			capacity[c] = units
+		}
+	}
+	return capacity
+}
+
+// clear sells the quarter's demand to the producers according to their
+// market share, limited by their capacity, and offers what is left over to
+// whoever still has spare capacity. It returns the units each sold.
+func (m *Market) clear(capacity, share map[*Company]int, demand int) map[*Company]int {
+	sold := map[*Company]int{}
+	totalShare := 0
+	for _, s := range share {
+		totalShare += s
+	}
+	remaining := demand
+	for c, s := range share {
+		units := min(capacity[c], proportion(demand, s, totalShare))
+		sold[c] = units
+		remaining -= units
+	}
+	spare := 0
+	for c, units := range capacity {
+		spare += units - sold[c]
+	}
+	if remaining > 0 && spare > 0 {
+		for c, units := range capacity {
+			free := units - sold[c]
+			sold[c] += min(free, proportion(remaining, free, spare))
+		}
+	}
+	return sold
+}
+
+func (w *World) MarketDailySubscriber() func(payloads.WorldTick) {
+	return func(payloads.WorldTick) {
+		w.mu.Lock()
+		defer w.mu.Unlock()
+		for _, m := range w.markets {
+			m.Demand.Value = max(0, m.Demand.Value+m.Demand.CalcUpdate())
+		}
+	}
+}
+
+// MarketSubscriber clears every industry at the end of the quarter, so each
+// company's operating revenue is what it sold at the market price, and lets
+// the next quarter's supply contracts for what was sold.
+func (w *World) MarketSubscriber() func(payloads.WorldTick) {
+	return func(p payloads.WorldTick) {
+		w.mu.Lock()
+		defer w.mu.Unlock()
+		revenue := map[*Company]int{}
+		sales := map[Industry]map[*Company]int{}
+		spare := map[Industry]map[*Company]int{}
+		for _, m := range w.markets {
+			capacity := w.producers(m)
+			share := map[*Company]int{}
+			total := 0
+			for c, units := range capacity {
+				share[c] = c.marketShare(m.Industry, units)
+				total += units
+			}
+			sold := m.clear(capacity, share, m.Demand.Value)
+			sales[m.Industry] = sold
+			spare[m.Industry] = map[*Company]int{}
+			for c, units := range capacity {
+				spare[m.Industry][c] = units - sold[c]
+			}
+			units := 0
+			for c, u := range sold {
+				units += u
+				price := m.Price
+				price.Value *= u
+				local, err := w.fx.Convert(price, c.DefaultCurrency, p.EGT)
+				if err != nil {
+					log.Println(err)
+					continue
+				}
+				revenue[c] += toMinor(local)
+			}
+
+			update := payloads.QuarterlyIndustryUpdate{
+				Industry:     string(m.Industry),
+				Quarter:      p.Quarter,
+				Demand:       m.Demand.Value,
+				Capacity:     total,
+				Sold:         units,
+				Producers:    len(capacity),
+				Currency:     m.Price.Currency,
+				CurrencyUnit: m.Price.Unit,
+				Price:        m.Price.Value,
+			}
+			if total > 0 {
+				update.Utilization = float64(units) / float64(total)
+				m.reprice(m.Demand.Value, total)
+			}
+			if err := w.nc.Publish(subjects.QuarterlyIndustryUpdate(string(m.Industry), p.Quarter), update); err != nil {
+				fmt.Println(err)
+			}
+		}
+
+		for c, sum := range revenue {
+			c.sell(money(c.DefaultCurrency, sum))
+		}
+		w.contracts = w.contractSupplies(sales, spare, p.EGT)
+	}
+}
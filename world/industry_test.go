@@ -0,0 +1,84 @@
+package world
+
+import "testing"
+
+func TestMarketReprice(t *testing.T) {
+	tests := []struct {
+		name     string
+		market   Market
+		demand   int
+		capacity int
+		expected int
+	}{
+		{"balanced", Market{Sensitivity: 10}, 100, 100, 1000},
+		{"demand outruns capacity", Market{Sensitivity: 10}, 110, 100, 1010},
+		{"demand falls short", Market{Sensitivity: 10}, 90, 100, 990},
+		{"no capacity", Market{Sensitivity: 10}, 100, 0, 1000},
+		{"move capped", Market{Sensitivity: 10, MaxMove: 500}, 200, 100, 1050},
+		{"fall capped", Market{Sensitivity: 10, MaxMove: 500}, 0, 100, 950},
+		{"held within range", Market{Sensitivity: 100, PriceRange: 2}, 300, 100, 2000},
+		{"never free", Market{Sensitivity: 1000}, 0, 100, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := tt.market
+			m.Price = money("USD", 1000)
+			m.opening = 1000
+			m.reprice(tt.demand, tt.capacity)
+			if m.Price.Value != tt.expected {
+				t.Errorf("expected %d, got %d", tt.expected, m.Price.Value)
+			}
+		})
+	}
+}
+
+func TestMarketClear(t *testing.T) {
+	a, b := &Company{Code: "A"}, &Company{Code: "B"}
+	tests := []struct {
+		name     string
+		capacity map[*Company]int
+		share    map[*Company]int
+		demand   int
+		expected map[*Company]int
+	}{
+		{
+			name:     "split by share",
+			capacity: map[*Company]int{a: 100, b: 100},
+			share:    map[*Company]int{a: 3, b: 1},
+			demand:   100,
+			expected: map[*Company]int{a: 75, b: 25},
+		},
+		{
+			name:     "leftover goes to spare capacity",
+			capacity: map[*Company]int{a: 50, b: 100},
+			share:    map[*Company]int{a: 3, b: 1},
+			demand:   100,
+			expected: map[*Company]int{a: 50, b: 50},
+		},
+		{
+			name:     "demand above capacity",
+			capacity: map[*Company]int{a: 50, b: 50},
+			share:    map[*Company]int{a: 1, b: 1},
+			demand:   500,
+			expected: map[*Company]int{a: 50, b: 50},
+		},
+		{
+			name:     "no demand",
+			capacity: map[*Company]int{a: 50, b: 50},
+			share:    map[*Company]int{a: 1, b: 1},
+			demand:   0,
+			expected: map[*Company]int{a: 0, b: 0},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := &Market{}
+			sold := m.clear(tt.capacity, tt.share, tt.demand)
+			for c, units := range tt.expected {
+				if sold[c] != units {
+					t.Errorf("%s: expected %d, got %d", c.Code, units, sold[c])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,194 @@
+package world
+
+import (
+	"log"
+	"sort"
+
+	"github.com/jxlxx/GreenIsland/bank"
+	"github.com/jxlxx/GreenIsland/payloads"
+	"github.com/jxlxx/GreenIsland/subjects"
+)
+
+// IPO sets how a private company goes public. It lists once it has been
+// private for Quarters and is making money, or when an admin asks it to,
+// offering Float basis points of its shares on top of those its founders
+// keep. The book is built between Discount basis points below its fair value
+// and the fair value itself.
+type IPO struct {
+	Quarters int `yaml:"quarters"`
+	Float    int `yaml:"float"`
+	Discount int `yaml:"discount"`
+}
+
+// ipoConfidence is where in the price range, in basis points, investors
+// bid in each phase of their business cycle.
+var ipoConfidence = map[CompanyCycle]int{
+	Expansion: 10000,
+	Peak:      10000,
+	Recovery:  7500,
+	Recession: 2500,
+}
+
+// ipoOrder is an investor's bid for shares at up to price, in minor units of
+// the company's currency.
+type ipoOrder struct {
+	investor bank.AccountRef
+	currency bank.CurrencyCode
+	price    int
+	shares   int
+}
+
+// buildBook finds the highest price at which the orders take up the whole
+// offering and allocates it pro rata between the orders at or above that
+// price. An undersubscribed book clears at the lowest bid and every order is
+// filled.
+func buildBook(orders []ipoOrder, offered int) (int, []int) {
+	sort.SliceStable(orders, func(i, j int) bool { return orders[i].price > orders[j].price })
+	price, demand := 0, 0
+	for _, o := range orders {
+		if o.shares <= 0 {
+			continue
+		}
+		price = o.price
+		demand += o.shares
+		if demand >= offered {
+			break
+		}
+	}
+	allocation := make([]int, len(orders))
+	for i, o := range orders {
+		if o.price < price || o.shares <= 0 {
+			continue
+		}
+		allocation[i] = min(o.shares, proportion(offered, o.shares, max(demand, offered)))
+	}
+	return price, allocation
+}
+
+// readyToList is true once the company should go public. It also counts the
+// quarters the company has been private.
+func (c *Company) readyToList() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.Private || c.closed {
+		return false
+	}
+	c.quartersPrivate++
+	if c.listing {
+		return true
+	}
+	return c.quartersPrivate >= c.IPO.Quarters && c.runRateEarnings() > 0
+}
+
+// priceRange is where the book is built, per share in minor units.
+func (c *Company) priceRange() (int, int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	high := c.fromMicro(c.fairValue(), bank.Minor)
+	return proportion(high, 10000-c.IPO.Discount, 10000), high
+}
+
+// offering is the number of new shares the company floats.
+func (c *Company) offering() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return proportion(c.OutstandingShares, c.IPO.Float, 10000)
+}
+
+// list sells the allocated shares and makes the company public. Investors
+// pay in their own currency at cost, which has been converted for them. If
+// nothing sells the offering is withdrawn and the company stays private.
+func (c *Company) list(orders []ipoOrder, allocation []int, cost []bank.CurrencyValue, update payloads.IPOUpdate) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for i, o := range orders {
+		shares := allocation[i]
+		if shares <= 0 {
+			continue
+		}
+		proceeds := money(c.DefaultCurrency, shares*update.Price)
+		if err := transfer(c.nc, o.investor, c.account, cost[i], proceeds); err != nil {
+			log.Println(c.Code, err)
+			continue
+		}
+		if err := c.broker.SetSettlement(o.investor.AccountID, o.investor); err != nil {
+			log.Println(c.Code, err)
+		}
+		if err := c.broker.Credit(o.investor.AccountID, c.Code, shares); err != nil {
+			log.Println(c.Code, err)
+			if err := transfer(c.nc, c.account, o.investor, proceeds, cost[i]); err != nil {
+				log.Println(err)
+			}
+			continue
+		}
+		c.book(LiquidAssetsAccount, ShareCapitalAccount, proceeds.Value, "initial public offering")
+		c.OutstandingShares += shares
+		update.Sold += shares
+		update.Proceeds += proceeds.Value
+		update.Investors++
+	}
+	c.BalanceSheet.sync(c.ledger)
+	update.Company = c.Code
+	update.Status = "withdrawn"
+	if update.Sold > 0 {
+		c.Private = false
+		c.listing = false
+		c.Bid, c.Ask = c.UpdateBidAsk()
+		update.Status = "listed"
+	}
+	update.CurrencyCode = c.DefaultCurrency
+	update.CurrencyUnit = bank.Minor
+	if err := c.nc.Publish(subjects.IPO(c.Code), update); err != nil {
+		log.Println(err)
+	}
+}
+
+// goPublic builds a book for the company's offering from the households of
+// every country. Each bids across the price range as confidently as its own
+// business cycle allows, for shares in proportion to its economy.
+func (w *World) goPublic(c *Company, p payloads.WorldTick) {
+	low, high := c.priceRange()
+	offered := c.offering()
+	if high <= 0 || offered <= 0 {
+		return
+	}
+	gdp := map[*Country]int{}
+	total := 0
+	for _, country := range w.countries {
+		v, err := w.fx.Convert(money(country.Currency, country.gdp()), c.DefaultCurrency, p.EGT)
+		if err != nil {
+			log.Println(err)
+			continue
+		}
+		gdp[country] = v.Value
+		total += v.Value
+	}
+	orders := []ipoOrder{}
+	for country, size := range gdp {
+		orders = append(orders, ipoOrder{
+			investor: country.households,
+			currency: country.Currency,
+			price:    low + proportion(high-low, ipoConfidence[country.outlook().Phase], 10000),
+			shares:   proportion(2*offered, size, total),
+		})
+	}
+	price, allocation := buildBook(orders, offered)
+	cost := make([]bank.CurrencyValue, len(orders))
+	for i, o := range orders {
+		v, err := w.fx.Convert(money(c.DefaultCurrency, allocation[i]*price), o.currency, p.EGT)
+		if err != nil {
+			log.Println(err)
+			allocation[i] = 0
+			continue
+		}
+		cost[i] = v
+	}
+	c.list(orders, allocation, cost, payloads.IPOUpdate{
+		Quarter: p.Quarter,
+		Offered: offered,
+		Low:     low,
+		High:    high,
+		Price:   price,
+		Orders:  len(orders),
+	})
+}
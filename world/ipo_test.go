@@ -0,0 +1,76 @@
+package world
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestBuildBook(t *testing.T) {
+	tests := []struct {
+		name       string
+		orders     []ipoOrder
+		offered    int
+		price      int
+		allocation []int
+	}{
+		{
+			name:       "oversubscribed",
+			orders:     []ipoOrder{{price: 100, shares: 60}, {price: 90, shares: 60}, {price: 80, shares: 50}},
+			offered:    100,
+			price:      90,
+			allocation: []int{50, 50, 0},
+		},
+		{
+			name:       "undersubscribed",
+			orders:     []ipoOrder{{price: 100, shares: 30}, {price: 90, shares: 20}},
+			offered:    100,
+			price:      90,
+			allocation: []int{30, 20},
+		},
+		{
+			name:       "exactly subscribed",
+			orders:     []ipoOrder{{price: 120, shares: 40}, {price: 110, shares: 60}, {price: 100, shares: 10}},
+			offered:    100,
+			price:      110,
+			allocation: []int{40, 60, 0},
+		},
+		{
+			name:       "orders sorted by price",
+			orders:     []ipoOrder{{price: 80, shares: 50}, {price: 100, shares: 60}, {price: 90, shares: 60}},
+			offered:    100,
+			price:      90,
+			allocation: []int{50, 50, 0},
+		},
+		{
+			name:       "empty orders ignored",
+			orders:     []ipoOrder{{price: 150, shares: 0}, {price: 100, shares: 100}},
+			offered:    50,
+			price:      100,
+			allocation: []int{0, 50},
+		},
+		{
+			name:       "no orders",
+			offered:    100,
+			price:      0,
+			allocation: []int{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			price, allocation := buildBook(tt.orders, tt.offered)
+			if price != tt.price {
+				t.Errorf("expected price %d, got %d", tt.price, price)
+			}
+			if !reflect.DeepEqual(allocation, tt.allocation) {
+				t.Errorf("expected allocation %v, got %v", tt.allocation, allocation)
+			}
+			sold := 0
+			for _, a := range allocation {
+				sold += a
+			}
+			if sold > tt.offered {
+				t.Errorf("allocated %d of %d shares", sold, tt.offered)
+			}
+		})
+	}
+}
@@ -0,0 +1,198 @@
+package world
+
+import (
+	"fmt"
+
+	"github.com/jxlxx/GreenIsland/bank"
+)
+
+type LedgerAccount string
+
+const (
+	LiquidAssetsAccount         LedgerAccount = "liquid_assets"
+	ForeignCashAccount          LedgerAccount = "foreign_cash"
+	MarketableSecuritiesAccount LedgerAccount = "marketable_securities"
+	AccountsReceivablesAccount  LedgerAccount = "accounts_receivables"
+	InventoryAccount            LedgerAccount = "inventory"
+	PrepaidExpensesAccount      LedgerAccount = "prepaid_expenses"
+	CapitalAssetsAccount        LedgerAccount = "capital_assets"
+	IntangibleAssetsAccount     LedgerAccount = "intangible_assets"
+	InvestmentsAccount          LedgerAccount = "investments"
+
+	AccountsPayableAccount LedgerAccount = "accounts_payable"
+	WagesPayableAccount    LedgerAccount = "wages_payable"
+	InterestPayableAccount LedgerAccount = "interest_payable"
+	DeferredRevenueAccount LedgerAccount = "deferred_revenue"
+	DeferredTaxesAccount   LedgerAccount = "deferred_taxes"
+	ShortTermDebtsAccount  LedgerAccount = "short_term_debts"
+	LongTermDebtsAccount   LedgerAccount = "long_term_debts"
+
+	DividendsPayableAccount LedgerAccount = "dividends_payable"
+
+	ShareCapitalAccount     LedgerAccount = "share_capital"
+	RetainedEarningsAccount LedgerAccount = "retained_earnings"
+	TreasuryStockAccount    LedgerAccount = "treasury_stock"
+
+	OperatingRevenueAccount       LedgerAccount = "operating_revenue"
+	ExportsAccount                LedgerAccount = "exports"
+	NonOperatingRevenueAccount    LedgerAccount = "non_operating_revenue"
+	ProductionExpensesAccount     LedgerAccount = "production_expenses"
+	AdministrativeExpensesAccount LedgerAccount = "administrative_expenses"
+	DepreciationAccount           LedgerAccount = "depreciation"
+	WagesAccount                  LedgerAccount = "wages"
+	InterestAccount               LedgerAccount = "interest"
+	WriteOffsAccount              LedgerAccount = "write_offs"
+	DebtForgivenAccount           LedgerAccount = "debt_forgiven"
+	FXTranslationAccount          LedgerAccount = "fx_translation"
+)
+
+type accountKind int
+
+const (
+	assetAccount accountKind = iota
+	liabilityAccount
+	equityAccount
+	contraEquityAccount
+	revenueAccount
+	expenseAccount
+)
+
+var ledgerAccounts = map[LedgerAccount]accountKind{
+	LiquidAssetsAccount:           assetAccount,
+	ForeignCashAccount:            assetAccount,
+	MarketableSecuritiesAccount:   assetAccount,
+	AccountsReceivablesAccount:    assetAccount,
+	InventoryAccount:              assetAccount,
+	PrepaidExpensesAccount:        assetAccount,
+	CapitalAssetsAccount:          assetAccount,
+	IntangibleAssetsAccount:       assetAccount,
+	InvestmentsAccount:            assetAccount,
+	AccountsPayableAccount:        liabilityAccount,
+	WagesPayableAccount:           liabilityAccount,
+	InterestPayableAccount:        liabilityAccount,
+	DeferredRevenueAccount:        liabilityAccount,
+	DeferredTaxesAccount:          liabilityAccount,
+	ShortTermDebtsAccount:         liabilityAccount,
+	LongTermDebtsAccount:          liabilityAccount,
+	DividendsPayableAccount:       liabilityAccount,
+	ShareCapitalAccount:           equityAccount,
+	RetainedEarningsAccount:       equityAccount,
+	TreasuryStockAccount:          contraEquityAccount,
+	OperatingRevenueAccount:       revenueAccount,
+	ExportsAccount:                revenueAccount,
+	NonOperatingRevenueAccount:    revenueAccount,
+	ProductionExpensesAccount:     expenseAccount,
+	AdministrativeExpensesAccount: expenseAccount,
+	DepreciationAccount:           expenseAccount,
+	WagesAccount:                  expenseAccount,
+	InterestAccount:               expenseAccount,
+	WriteOffsAccount:              expenseAccount,
+	DebtForgivenAccount:           revenueAccount,
+	FXTranslationAccount:          revenueAccount,
+}
+
+type Entry struct {
+	Debit  LedgerAccount
+	Credit LedgerAccount
+	Amount int
+	Memo   string
+}
+
+// Ledger is a company's general ledger, kept in minor units of its default
+// currency. Balances are stored debit positive. Revenue and expense accounts
+// hold the current quarter and are closed into retained earnings.
+type Ledger struct {
+	Currency bank.CurrencyCode
+
+	balances map[LedgerAccount]int
+	entries  []Entry
+}
+
+func NewLedger(code bank.CurrencyCode) *Ledger {
+	return &Ledger{
+		Currency: code,
+		balances: map[LedgerAccount]int{},
+	}
+}
+
+// Post records one balanced entry. A negative amount swaps debit and credit.
+func (l *Ledger) Post(debit, credit LedgerAccount, amount int, memo string) error {
+	if _, ok := ledgerAccounts[debit]; !ok {
+		return fmt.Errorf("err: unknown ledger account %s", debit)
+	}
+	if _, ok := ledgerAccounts[credit]; !ok {
+		return fmt.Errorf("err: unknown ledger account %s", credit)
+	}
+	if amount < 0 {
+		debit, credit, amount = credit, debit, -amount
+	}
+	if amount == 0 {
+		return nil
+	}
+	l.balances[debit] += amount
+	l.balances[credit] -= amount
+	l.entries = append(l.entries, Entry{
+		Debit:  debit,
+		Credit: credit,
+		Amount: amount,
+		Memo:   memo,
+	})
+	return nil
+}
+
+// Balance is the account's balance on its normal side.
+func (l *Ledger) Balance(a LedgerAccount) int {
+	switch ledgerAccounts[a] {
+	case assetAccount, contraEquityAccount, expenseAccount:
+		return l.balances[a]
+	default:
+		return -l.balances[a]
+	}
+}
+
+func (l *Ledger) total(kind accountKind) int {
+	sum := 0
+	for a, k := range ledgerAccounts {
+		if k == kind {
+			sum += l.Balance(a)
+		}
+	}
+	return sum
+}
+
+func (l *Ledger) Assets() int      { return l.total(assetAccount) }
+func (l *Ledger) Liabilities() int { return l.total(liabilityAccount) }
+
+// Equity includes the current quarter's earnings before they are closed.
+func (l *Ledger) Equity() int {
+	return l.total(equityAccount) - l.total(contraEquityAccount) + l.NetIncome()
+}
+
+func (l *Ledger) NetIncome() int {
+	return l.total(revenueAccount) - l.total(expenseAccount)
+}
+
+// Reconcile verifies that the liquid assets on the books are the cash the
+// bank says the company holds.
+func (l *Ledger) Reconcile(cash int) error {
+	if liquid := l.Balance(LiquidAssetsAccount); liquid != cash {
+		return fmt.Errorf("err: books do not match the bank: liquid assets %d != cash %d", liquid, cash)
+	}
+	return nil
+}
+
+// Close moves the quarter's revenue and expenses into retained earnings and
+// returns the entries posted since the last close.
+func (l *Ledger) Close() []Entry {
+	for a, k := range ledgerAccounts {
+		switch k {
+		case revenueAccount:
+			l.Post(a, RetainedEarningsAccount, l.Balance(a), "close")
+		case expenseAccount:
+			l.Post(RetainedEarningsAccount, a, l.Balance(a), "close")
+		}
+	}
+	entries := l.entries
+	l.entries = nil
+	return entries
+}
@@ -0,0 +1,143 @@
+package world
+
+import "testing"
+
+type posting struct {
+	debit, credit LedgerAccount
+	amount        int
+}
+
+func TestLedgerReconcile(t *testing.T) {
+	tests := []struct {
+		name     string
+		postings []posting
+		cash     int
+		matched  bool
+	}{
+		{
+			name:    "empty",
+			matched: true,
+		},
+		{
+			name: "capital raised and spent",
+			postings: []posting{
+				{LiquidAssetsAccount, ShareCapitalAccount, 1000},
+				{CapitalAssetsAccount, LiquidAssetsAccount, 400},
+			},
+			cash:    600,
+			matched: true,
+		},
+		{
+			name: "sales not yet collected",
+			postings: []posting{
+				{LiquidAssetsAccount, ShareCapitalAccount, 1000},
+				{AccountsReceivablesAccount, OperatingRevenueAccount, 300},
+			},
+			cash:    1000,
+			matched: true,
+		},
+		{
+			name: "negative amount swaps sides",
+			postings: []posting{
+				{LiquidAssetsAccount, ShareCapitalAccount, 1000},
+				{LiquidAssetsAccount, LongTermDebtsAccount, -200},
+			},
+			cash:    800,
+			matched: true,
+		},
+		{
+			name: "cash missing from the bank",
+			postings: []posting{
+				{LiquidAssetsAccount, ShareCapitalAccount, 1000},
+			},
+			cash:    999,
+			matched: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := NewLedger("USD")
+			for _, p := range tt.postings {
+				if err := l.Post(p.debit, p.credit, p.amount, "test"); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := l.Reconcile(tt.cash); (err == nil) != tt.matched {
+				t.Errorf("expected matched %t, got %v", tt.matched, err)
+			}
+		})
+	}
+}
+
+func TestLedgerPostUnknownAccount(t *testing.T) {
+	l := NewLedger("USD")
+	if err := l.Post("cash", ShareCapitalAccount, 100, "test"); err == nil {
+		t.Error("expected an error for an unknown account")
+	}
+	if len(l.entries) != 0 {
+		t.Errorf("expected no entries, got %d", len(l.entries))
+	}
+}
+
+func TestLedgerClose(t *testing.T) {
+	tests := []struct {
+		name     string
+		postings []posting
+		retained int
+	}{
+		{
+			name: "profit",
+			postings: []posting{
+				{AccountsReceivablesAccount, OperatingRevenueAccount, 500},
+				{ProductionExpensesAccount, AccountsPayableAccount, 200},
+				{InterestAccount, InterestPayableAccount, 50},
+			},
+			retained: 250,
+		},
+		{
+			name: "loss",
+			postings: []posting{
+				{AccountsReceivablesAccount, ExportsAccount, 100},
+				{WagesAccount, WagesPayableAccount, 300},
+			},
+			retained: -200,
+		},
+		{
+			name: "no trading",
+			postings: []posting{
+				{LiquidAssetsAccount, ShareCapitalAccount, 100},
+			},
+			retained: 0,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := NewLedger("USD")
+			for _, p := range tt.postings {
+				if err := l.Post(p.debit, p.credit, p.amount, "test"); err != nil {
+					t.Fatal(err)
+				}
+			}
+			equity := l.Equity()
+			entries := l.Close()
+			if len(entries) < len(tt.postings) {
+				t.Errorf("expected at least %d entries, got %d", len(tt.postings), len(entries))
+			}
+			if got := l.Balance(RetainedEarningsAccount); got != tt.retained {
+				t.Errorf("expected retained earnings %d, got %d", tt.retained, got)
+			}
+			if got := l.NetIncome(); got != 0 {
+				t.Errorf("expected no net income after close, got %d", got)
+			}
+			if got := l.Equity(); got != equity {
+				t.Errorf("expected equity %d after close, got %d", equity, got)
+			}
+			if assets, claims := l.Assets(), l.Liabilities()+l.Equity(); assets != claims {
+				t.Errorf("expected assets of %d to match liabilities and equity, got %d", claims, assets)
+			}
+			if len(l.Close()) != 0 {
+				t.Error("expected a second close to post nothing")
+			}
+		})
+	}
+}
@@ -0,0 +1,179 @@
+package world
+
+import (
+	"errors"
+	"log"
+	"slices"
+
+	"github.com/google/uuid"
+	"github.com/nats-io/nats.go"
+
+	"github.com/jxlxx/GreenIsland/bank"
+	"github.com/jxlxx/GreenIsland/payloads"
+	"github.com/jxlxx/GreenIsland/subjects"
+)
+
+// companyLoan is the company's side of a bank loan. Interest is accrued in
+// the books every day and trued up to what the bank charges on payment. The
+// loan is long-term debt until it has a year left to run. A repayment the
+// bank never confirmed is kept and sent again.
+type companyLoan struct {
+	bank.Loan
+	accrued   int
+	current   bool
+	repayment *bank.Repayment
+}
+
+func (l *companyLoan) debtAccount() LedgerAccount {
+	if l.current {
+		return ShortTermDebtsAccount
+	}
+	return LongTermDebtsAccount
+}
+
+func loanRequest(nc *nats.EncodedConn, subject string, req any) (bank.LoanResponse, error) {
+	resp := bank.LoanResponse{}
+	err := bankReply(nc, subject, req, &resp)
+	return resp, err
+}
+
+// quarterlyInterest is what the company's loans cost at their current
+// balances, in minor units.
+func (c *Company) quarterlyInterest() int {
+	sum := 0
+	for _, l := range c.loans {
+		sum += l.DailyInterest() * daysPerQuarter
+	}
+	return sum
+}
+
+// borrowFromBank applies to the company's bank for a loan with the books as they
+// stand. A company that has not been rated yet is rated on them too. The
+// caller holds c.mu, which is let go while the bank decides.
+func (c *Company) borrowFromBank(principal, day int) {
+	if principal <= 0 || c.application != nil {
+		return
+	}
+	rating := c.rating
+	if rating == "" {
+		rating = c.creditRating(c.creditRatios())
+	}
+	c.applyForLoan(bank.LoanApplication{
+		Reference: uuid.New(),
+		Borrower:  c.account.AccountID,
+		Currency:  c.DefaultCurrency,
+		Principal: principal,
+		Day:       day,
+		Rating:    rating,
+		Financials: bank.Financials{
+			Assets:      c.ledger.Assets(),
+			Liabilities: c.ledger.Liabilities(),
+			Equity:      c.ledger.Equity(),
+			Earnings:    c.runRateEarnings(),
+			Interest:    c.quarterlyInterest(),
+		},
+	})
+}
+
+// applyForLoan sends a loan application to the company's bank. One the bank
+// never answered is kept to be sent again the next day, since the bank may
+// have lent the money. The caller holds c.mu, which is let go while the bank
+// decides.
+func (c *Company) applyForLoan(a bank.LoanApplication) {
+	subject := bank.AdminSubject(c.account.CountryCode, c.account.BankCode, "loan")
+	var resp bank.LoanResponse
+	var err error
+	c.unlocked(func() { resp, err = loanRequest(c.nc, subject, a) })
+	if errors.Is(err, errUnconfirmed) {
+		c.application = &a
+		return
+	}
+	if err != nil {
+		c.publishLoan("rejected", bank.Loan{Principal: a.Principal}, err.Error())
+		return
+	}
+	l := &companyLoan{Loan: resp.Loan, current: resp.Loan.Maturity-a.Day <= daysPerYear}
+	c.loans = append(c.loans, l)
+	c.book(LiquidAssetsAccount, l.debtAccount(), l.Principal, "loan")
+	c.BalanceSheet.sync(c.ledger)
+	c.publishLoan("approved", l.Loan, "")
+}
+
+// loanDay accrues interest on every loan, moves loans due within a year to
+// short-term debt and makes the payments that fall due. The caller holds
+// c.mu, which is let go while each payment is made.
+func (c *Company) loanDay(day int) {
+	if a := c.application; a != nil {
+		c.application = nil
+		c.applyForLoan(*a)
+	}
+	for _, l := range slices.Clone(c.loans) {
+		interest := l.DailyInterest()
+		c.book(InterestAccount, InterestPayableAccount, interest, "interest accrued")
+		l.accrued += interest
+		if !l.current && l.Maturity-day <= daysPerYear {
+			c.book(LongTermDebtsAccount, ShortTermDebtsAccount, l.Outstanding, "debt due within a year")
+			l.current = true
+		}
+		if day >= l.NextPayment || l.repayment != nil {
+			c.repay(l, day)
+		}
+	}
+	c.loans = slices.DeleteFunc(c.loans, func(l *companyLoan) bool { return l.Outstanding <= 0 })
+	c.BalanceSheet.sync(c.ledger)
+}
+
+// repay makes a loan's installment, or sends again one the bank never
+// confirmed with the same reference, so it is taken only once. The books
+// follow what the bank says it took. The caller holds c.mu, which is let go
+// while the bank takes the payment.
+func (c *Company) repay(l *companyLoan, day int) {
+	if l.repayment == nil {
+		l.repayment = &bank.Repayment{Reference: uuid.New(), LoanID: l.ID, Day: day}
+	}
+	repayment := *l.repayment
+	subject := bank.AdminSubject(c.account.CountryCode, c.account.BankCode, "repay")
+	var resp bank.LoanResponse
+	var err error
+	c.unlocked(func() { resp, err = loanRequest(c.nc, subject, repayment) })
+	if errors.Is(err, errUnconfirmed) {
+		return
+	}
+	l.repayment = nil
+	if err != nil {
+		// The installment is missed; try again with the next one rather than
+		// every day, so missed payments count installments.
+		c.missedLoanPayments++
+		l.NextPayment = day + l.PaymentDays
+		c.publishLoan("missed", l.Loan, err.Error())
+		return
+	}
+	c.missedLoanPayments = 0
+	c.book(InterestAccount, InterestPayableAccount, resp.Interest-l.accrued, "interest charged")
+	c.book(InterestPayableAccount, LiquidAssetsAccount, resp.Interest, "interest paid")
+	c.book(l.debtAccount(), LiquidAssetsAccount, resp.Principal, "principal repaid")
+	l.accrued = 0
+	l.Loan = resp.Loan
+	if l.Outstanding <= 0 {
+		c.publishLoan("repaid", l.Loan, "")
+	}
+}
+
+func (c *Company) publishLoan(status string, l bank.Loan, message string) {
+	update := payloads.LoanUpdate{
+		Company:      c.Code,
+		Bank:         c.BankCode,
+		Status:       status,
+		Message:      message,
+		CurrencyCode: c.DefaultCurrency,
+		CurrencyUnit: bank.Minor,
+		Principal:    l.Principal,
+		Outstanding:  l.Outstanding,
+		Rate:         l.Rate,
+		Payment:      l.Payment,
+		Maturity:     l.Maturity,
+	}
+	if err := c.nc.Publish(subjects.Loan(c.Code), update); err != nil {
+		log.Println(err)
+	}
+}
@@ -0,0 +1,668 @@
+package world
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"sync"
+
+	"github.com/google/uuid"
+	"github.com/nats-io/nats.go/micro"
+
+	"github.com/jxlxx/GreenIsland/bank"
+	"github.com/jxlxx/GreenIsland/broker"
+	"github.com/jxlxx/GreenIsland/payloads"
+	"github.com/jxlxx/GreenIsland/subjects"
+)
+
+// Acquisitions sets how the company's tender offers run. Word of an offer
+// gets out RumourDays before it is announced and it stays open for OfferDays.
+// It completes if holders of at least MinAcceptance basis points of the
+// target's shares accept, and the rest are then bought out on the same terms.
+type Acquisitions struct {
+	RumourDays    int `yaml:"rumour_days"`
+	OfferDays     int `yaml:"offer_days"`
+	MinAcceptance int `yaml:"min_acceptance"`
+}
+
+const (
+	cashConsideration  = "cash"
+	stockConsideration = "stock"
+)
+
+// tender is a tender offer in progress. The price is per target share in
+// minor units of the target's currency. Accepted holds the shares each holder
+// has put on hold for the offer.
+type tender struct {
+	mu       sync.Mutex
+	closed   bool
+	offer    payloads.TenderOffer
+	acquirer *Company
+	target   *Company
+	announce int
+	expiry   int
+	price    int
+	accepted map[uuid.UUID]int
+}
+
+// TenderOffer takes an admin's tender offer for a company.
+func (w *World) TenderOffer(req micro.Request) {
+	o := payloads.TenderOffer{}
+	if err := json.Unmarshal(req.Data(), &o); err != nil {
+		respondError(req, "cannot parse request")
+		return
+	}
+	if o.Consideration != cashConsideration && o.Consideration != stockConsideration {
+		respondError(req, "consideration must be cash or stock")
+		return
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	t := &tender{offer: o}
+	for _, c := range w.companies {
+		switch c.Code {
+		case o.Acquirer:
+			t.acquirer = c
+		case o.Target:
+			t.target = c
+		}
+	}
+	if t.acquirer == nil || t.target == nil || t.acquirer == t.target {
+		respondError(req, "offer needs an acquirer and a different target")
+		return
+	}
+	for _, other := range w.tenders {
+		if other.target == t.target {
+			respondError(req, fmt.Sprintf("%s is already subject to an offer", o.Target))
+			return
+		}
+	}
+	w.tenders = append(w.tenders, t)
+	if err := req.RespondJSON(bank.Response{Status: "OK"}); err != nil {
+		log.Println(err)
+	}
+}
+
+// TenderSubscriber moves every tender offer along. A new offer is rumoured
+// on the first day it is seen.
+func (w *World) TenderSubscriber() func(payloads.WorldTick) {
+	return func(p payloads.WorldTick) {
+		w.mu.Lock()
+		tenders := w.tenders
+		w.mu.Unlock()
+		day := p.Days()
+		open := []*tender{}
+		for _, t := range tenders {
+			if w.tenderDay(t, day, p.EGT) {
+				open = append(open, t)
+			}
+		}
+		w.mu.Lock()
+		w.tenders = open
+		w.mu.Unlock()
+	}
+}
+
+// tenderDay runs one day of an offer and reports whether it is still open.
+func (w *World) tenderDay(t *tender, day, hour int) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	terms := t.acquirer.acquisitions()
+	switch {
+	case t.announce == 0:
+		t.announce = day + terms.RumourDays
+		t.expiry = t.announce + terms.OfferDays
+		w.publishTender(t, "rumoured", day, payloads.TenderUpdate{})
+	case day >= t.expiry && t.price > 0:
+		w.completeTender(t, day, hour, terms)
+		t.closed = true
+		return false
+	case day >= t.announce && t.price == 0:
+		ask, fair := t.target.tenderQuote()
+		if ask <= 0 {
+			w.publishTender(t, "withdrawn", day, payloads.TenderUpdate{Message: "target has no price"})
+			t.closed = true
+			return false
+		}
+		t.price = proportion(ask, 10000+t.offer.Premium, 10000)
+		t.accepted = w.acceptances(t, fair)
+		w.publishTender(t, "announced", day, payloads.TenderUpdate{})
+	}
+	return true
+}
+
+// tenderQuote is the target's ask and fair value per share, in minor units.
+func (c *Company) tenderQuote() (int, int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed || c.Private {
+		return 0, 0
+	}
+	return toMinor(c.Ask), c.fromMicro(c.fairValue(), bank.Minor)
+}
+
+func (c *Company) acquisitions() Acquisitions {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.Acquisitions
+}
+
+// acceptances decides for the households, which accept when the offer is
+// worth at least the fair value of their shares and put them on hold with
+// their broker. Every other holder decides for themselves through
+// AcceptTender.
+func (w *World) acceptances(t *tender, fair int) map[uuid.UUID]int {
+	accepted := map[uuid.UUID]int{}
+	if t.price < fair {
+		return accepted
+	}
+	for _, account := range w.households() {
+		available, err := w.broker.Get(account.AccountID, t.target.Code, broker.Available)
+		if err != nil || available <= 0 {
+			continue
+		}
+		if err := w.broker.Hold(account.AccountID, t.target.Code, available); err != nil {
+			log.Println(err)
+			continue
+		}
+		accepted[account.AccountID] = available
+	}
+	return accepted
+}
+
+// AcceptTender puts a holder's shares on hold for an announced tender offer.
+// They are bought when the offer completes and released if it lapses. The
+// request names the holder, so it is only served to admin clients.
+func (w *World) AcceptTender(req micro.Request) {
+	a := payloads.TenderAcceptance{}
+	if err := json.Unmarshal(req.Data(), &a); err != nil {
+		respondError(req, "cannot parse request")
+		return
+	}
+	if a.Shares <= 0 {
+		respondError(req, "shares must be positive")
+		return
+	}
+	w.mu.Lock()
+	var t *tender
+	for _, open := range w.tenders {
+		if open.target.Code == a.Target {
+			t = open
+		}
+	}
+	w.mu.Unlock()
+	if t == nil {
+		respondError(req, fmt.Sprintf("no offer for %s", a.Target))
+		return
+	}
+	shares, err := w.accept(t, a)
+	if err != nil {
+		respondError(req, err.Error())
+		return
+	}
+	if err := req.RespondJSON(payloads.TenderAcceptanceResponse{Status: "OK", Shares: shares, Price: t.price}); err != nil {
+		log.Println(err)
+	}
+}
+
+// accept puts up to the shares a holder asks for on hold for the offer and
+// returns how many that was. A cash offer pays into the holder's settlement
+// account with the broker.
+func (w *World) accept(t *tender, a payloads.TenderAcceptance) (int, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.closed || t.price == 0 {
+		return 0, fmt.Errorf("err: the offer for %s is not open", t.offer.Target)
+	}
+	if a.Holder == t.target.id || a.Holder == t.acquirer.id {
+		return 0, fmt.Errorf("err: %s cannot accept its own offer", a.Holder)
+	}
+	available, err := w.broker.Get(a.Holder, t.target.Code, broker.Available)
+	if err != nil {
+		return 0, err
+	}
+	shares := min(a.Shares, available)
+	if shares <= 0 {
+		return 0, fmt.Errorf("err: no %s shares available", t.target.Code)
+	}
+	if err := w.broker.Hold(a.Holder, t.target.Code, shares); err != nil {
+		return 0, err
+	}
+	t.accepted[a.Holder] += shares
+	return shares, nil
+}
+
+// tenderAccepted reports whether enough of the shares have been tendered for
+// the offer to complete.
+func tenderAccepted(accepted, total, minAcceptance int) bool {
+	return total > 0 && proportion(accepted, 10000, total) >= minAcceptance
+}
+
+// completeTender buys out every shareholder if enough have accepted and
+// merges the target into the acquirer. Otherwise, or if any holder cannot be
+// bought out, the offer lapses and the shares on hold are released.
+func (w *World) completeTender(t *tender, day, hour int, terms Acquisitions) {
+	holders, err := w.broker.Holders(t.target.Code)
+	if err != nil {
+		log.Println(err)
+		holders = map[uuid.UUID]int{}
+	}
+	delete(holders, t.target.id)
+	delete(holders, t.acquirer.id)
+	total, accepted := 0, 0
+	for _, shares := range holders {
+		total += shares
+	}
+	for _, shares := range t.accepted {
+		accepted += shares
+	}
+	update := payloads.TenderUpdate{Accepted: accepted, Holders: len(holders)}
+	lapse := func(message string) {
+		for holder, shares := range t.accepted {
+			if err := w.broker.Release(holder, t.target.Code, shares); err != nil {
+				log.Println(err)
+			}
+		}
+		update.Message = message
+		w.publishTender(t, "lapsed", day, update)
+	}
+	if !tenderAccepted(accepted, total, terms.MinAcceptance) {
+		lapse("too few shareholders accepted")
+		return
+	}
+	cost, err := w.fx.Convert(money(t.target.DefaultCurrency, total*t.price), t.acquirer.DefaultCurrency, hour)
+	if err != nil {
+		lapse(err.Error())
+		return
+	}
+	shortfall := max(0, t.target.loanPayoff()-t.target.liquid())
+	funding, err := w.fx.Convert(money(t.target.DefaultCurrency, shortfall), t.acquirer.DefaultCurrency, hour)
+	if err != nil {
+		lapse(err.Error())
+		return
+	}
+	need := funding.Value
+	if t.offer.Consideration == cashConsideration {
+		need += cost.Value
+	}
+	if t.acquirer.liquid() < need {
+		lapse("acquirer cannot pay")
+		return
+	}
+
+	update.Shares, update.SharesIssued, err = w.squeezeOut(t, holders, hour, t.acquirer.askPrice())
+	if err != nil {
+		lapse(err.Error())
+		return
+	}
+	paid, err := w.fx.Convert(money(t.target.DefaultCurrency, update.Shares*t.price), t.acquirer.DefaultCurrency, hour)
+	if err != nil {
+		log.Println(err)
+	}
+	update.Cost = paid.Value
+	t.acquirer.recordAcquisition(t.offer.Consideration, update.SharesIssued, paid.Value)
+	if shortfall > 0 {
+		if err := transfer(w.nc, t.acquirer.account, t.target.account, funding, money(t.target.DefaultCurrency, shortfall)); err != nil {
+			log.Println(err)
+			funding.Value = 0
+		} else {
+			t.acquirer.recordAcquisition(cashConsideration, 0, funding.Value)
+			t.target.receive(money(t.target.DefaultCurrency, shortfall), ShareCapitalAccount, "funded by "+t.acquirer.Code)
+		}
+	}
+
+	merged := t.target.delist(day)
+	w.removeCompany(t.target.Code)
+	cash, err := w.fx.Convert(money(t.target.DefaultCurrency, merged.balances[LiquidAssetsAccount]), t.acquirer.DefaultCurrency, hour)
+	if err == nil && cash.Value > 0 {
+		if err := transfer(w.nc, t.target.account, t.acquirer.account, money(t.target.DefaultCurrency, merged.balances[LiquidAssetsAccount]), cash); err != nil {
+			log.Println(err)
+			cash.Value = 0
+		}
+	}
+	merged.balances[LiquidAssetsAccount] = cash.Value
+	for a, v := range merged.balances {
+		if a == LiquidAssetsAccount {
+			continue
+		}
+		converted, err := w.fx.Convert(money(t.target.DefaultCurrency, v), t.acquirer.DefaultCurrency, hour)
+		if err != nil {
+			log.Println(err)
+			converted.Value = 0
+		}
+		merged.balances[a] = converted.Value
+	}
+	for a, v := range merged.income {
+		converted, err := w.fx.Convert(money(t.target.DefaultCurrency, v), t.acquirer.DefaultCurrency, hour)
+		if err != nil {
+			log.Println(err)
+			converted.Value = 0
+		}
+		merged.income[a] = converted.Value
+	}
+	merged.payable, merged.receivable = w.takeOverInvoices(t, hour)
+	merged.cost = paid.Value + funding.Value
+	update.Goodwill = t.acquirer.absorb(t.target.Code, merged)
+	w.publishTender(t, "completed", day, update)
+}
+
+// purchase is one holder bought out of the target.
+type purchase struct {
+	holder  uuid.UUID
+	shares  int
+	issued  int
+	account bank.AccountRef
+	cost    bank.CurrencyValue
+	price   bank.CurrencyValue
+}
+
+// squeezeOut buys out every holder on the offer's terms. It is all or
+// nothing: cash offers need every holder to have an account to be paid into,
+// and if any holder cannot be bought out those who were are given their
+// shares back. It returns the shares bought and the new shares issued.
+func (w *World) squeezeOut(t *tender, holders map[uuid.UUID]int, hour, ask int) (int, int, error) {
+	if t.offer.Consideration == cashConsideration {
+		for holder := range holders {
+			if _, err := w.broker.Settlement(holder); err != nil {
+				return 0, 0, fmt.Errorf("err: cannot pay %s: %w", holder, err)
+			}
+		}
+	}
+	done := []purchase{}
+	bought, issued := 0, 0
+	for holder, shares := range holders {
+		p, err := w.buyOut(t, holder, shares, hour, ask)
+		if err != nil {
+			for _, p := range done {
+				w.unwind(t, p)
+			}
+			return 0, 0, err
+		}
+		done = append(done, p)
+		bought += p.shares
+		issued += p.issued
+	}
+	return bought, issued, nil
+}
+
+// buyOut pays a holder for their target shares in cash, in the target's
+// currency, or in new shares of the acquirer at its ask, and then takes the
+// shares. Nothing changes hands unless both sides do.
+func (w *World) buyOut(t *tender, holder uuid.UUID, shares, hour, ask int) (purchase, error) {
+	p := purchase{holder: holder, shares: shares}
+	p.price = money(t.target.DefaultCurrency, shares*t.price)
+	cost, err := w.fx.Convert(p.price, t.acquirer.DefaultCurrency, hour)
+	if err != nil {
+		return p, err
+	}
+	p.cost = cost
+	if t.offer.Consideration == stockConsideration {
+		if ask <= 0 {
+			return p, fmt.Errorf("err: %s has no price", t.acquirer.Code)
+		}
+		p.issued = cost.Value / ask
+		if err := w.broker.Credit(holder, t.acquirer.Code, p.issued); err != nil {
+			return p, err
+		}
+		if err := w.takeShares(t, holder, shares); err != nil {
+			if err := w.broker.Transfer(holder, t.acquirer.id, t.acquirer.Code, p.issued, false); err != nil {
+				log.Println(err)
+			}
+			return p, err
+		}
+		return p, nil
+	}
+	p.account, err = w.broker.Settlement(holder)
+	if err != nil {
+		return p, err
+	}
+	if err := transfer(w.nc, t.acquirer.account, p.account, cost, p.price); err != nil {
+		return p, err
+	}
+	if err := w.takeShares(t, holder, shares); err != nil {
+		if err := transfer(w.nc, p.account, t.acquirer.account, p.price, cost); err != nil {
+			log.Println(err)
+		}
+		return p, err
+	}
+	return p, nil
+}
+
+// unwind gives a holder back the shares they were bought out of and takes
+// back what they were paid for them. Their shares are no longer on hold.
+func (w *World) unwind(t *tender, p purchase) {
+	delete(t.accepted, p.holder)
+	if err := w.broker.Transfer(t.acquirer.id, p.holder, t.target.Code, p.shares, false); err != nil {
+		log.Println(err)
+	}
+	if t.offer.Consideration == stockConsideration {
+		if err := w.broker.Transfer(p.holder, t.acquirer.id, t.acquirer.Code, p.issued, false); err != nil {
+			log.Println(err)
+		}
+		return
+	}
+	if err := transfer(w.nc, p.account, t.acquirer.account, p.price, p.cost); err != nil {
+		log.Println(err)
+	}
+}
+
+// takeShares moves a holder's target shares to the acquirer, those on hold
+// first. If the rest cannot be moved the ones on hold are given back and put
+// on hold again.
+func (w *World) takeShares(t *tender, holder uuid.UUID, shares int) error {
+	onHold := min(shares, t.accepted[holder])
+	if onHold > 0 {
+		if err := w.broker.Transfer(holder, t.acquirer.id, t.target.Code, onHold, true); err != nil {
+			return err
+		}
+	}
+	if shares > onHold {
+		if err := w.broker.Transfer(holder, t.acquirer.id, t.target.Code, shares-onHold, false); err != nil {
+			if err := w.broker.Transfer(t.acquirer.id, holder, t.target.Code, onHold, false); err != nil {
+				log.Println(err)
+			} else if err := w.broker.Hold(holder, t.target.Code, onHold); err != nil {
+				log.Println(err)
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// loanPayoff is what it takes to repay every loan in full, with a day of
+// interest to spare.
+func (c *Company) loanPayoff() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	sum := 0
+	for _, l := range c.loans {
+		sum += l.Outstanding + l.accrued + l.DailyInterest()
+	}
+	return sum
+}
+
+// takeOverInvoices makes the acquirer the party to the target's open supply
+// invoices, in its own currency, so that they are settled rather than
+// written off. It returns what the acquirer now owes and is owed on them.
+func (w *World) takeOverInvoices(t *tender, hour int) (int, int) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	payable, receivable := 0, 0
+	for _, inv := range w.invoices {
+		if inv.buyer == t.target {
+			owed, err := w.fx.Convert(inv.owed, t.acquirer.DefaultCurrency, hour)
+			if err != nil {
+				log.Println(err)
+			} else {
+				inv.buyer = t.acquirer
+				inv.owed = money(t.acquirer.DefaultCurrency, toMinor(owed))
+				payable += inv.owed.Value
+				t.acquirer.takeOverPayable(inv)
+			}
+		}
+		if inv.seller == t.target {
+			billed, err := w.fx.Convert(inv.billed, t.acquirer.DefaultCurrency, hour)
+			if err != nil {
+				log.Println(err)
+			} else {
+				inv.seller = t.acquirer
+				inv.billed = money(t.acquirer.DefaultCurrency, toMinor(billed))
+				receivable += inv.billed.Value
+			}
+		}
+	}
+	return payable, receivable
+}
+
+func (c *Company) liquid() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.ledger.Balance(LiquidAssetsAccount)
+}
+
+func (c *Company) askPrice() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return toMinor(c.Ask)
+}
+
+// recordAcquisition books what the acquirer paid for the target as an
+// investment until the target is absorbed.
+func (c *Company) recordAcquisition(consideration string, issued, cost int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if consideration == stockConsideration {
+		c.OutstandingShares += issued
+		c.book(InvestmentsAccount, ShareCapitalAccount, cost, "shares issued for acquisition")
+	} else {
+		c.book(InvestmentsAccount, LiquidAssetsAccount, cost, "acquisition")
+	}
+	c.BalanceSheet.sync(c.ledger)
+}
+
+// merger is what a delisted target brings to its acquirer, in minor units of
+// the target's currency.
+type merger struct {
+	balances   map[LedgerAccount]int
+	income     map[LedgerAccount]int
+	capacity   map[Industry]int
+	industries []Industry
+	employees  int
+	payable    int
+	receivable int
+	cost       int
+}
+
+// delist repays the target's loans on the change of control, closes it and
+// hands over its books. The acquirer has already put in whatever the target
+// lacked to repay its loans in full. Its shares are cancelled.
+func (c *Company) delist(day int) merger {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.repatriateAll()
+	if c.dividend != nil {
+		c.book(DividendsPayableAccount, RetainedEarningsAccount, c.ledger.Balance(DividendsPayableAccount), "dividend cancelled")
+		c.dividend = nil
+	}
+	c.payLoans(day, "on takeover")
+	m := merger{
+		balances: map[LedgerAccount]int{},
+		income: map[LedgerAccount]int{
+			OperatingRevenueAccount:       toMinor(c.Income.OperatingRevenue),
+			NonOperatingRevenueAccount:    toMinor(c.Income.NonOperatingRevenue),
+			ProductionExpensesAccount:     toMinor(c.Income.ProductionExpenses),
+			AdministrativeExpensesAccount: toMinor(c.Income.AdministrativeExpenses),
+			DepreciationAccount:           toMinor(c.Income.Depreciation),
+		},
+		capacity:   c.Industries.Capacity,
+		industries: c.Industries.PrimaryIndustries,
+		employees:  c.Employment.Employees.Value,
+	}
+	for a, kind := range ledgerAccounts {
+		switch kind {
+		case assetAccount, liabilityAccount:
+			m.balances[a] = c.ledger.Balance(a)
+		}
+	}
+	if err := c.broker.Cancel(c.Code); err != nil {
+		log.Println(c.Code, err)
+	}
+	c.OutstandingShares = 0
+	c.closed = true
+	return m
+}
+
+// absorb merges a delisted target into the company. Its assets and
+// liabilities replace the investment in it, and whatever was paid above its
+// net assets is goodwill, booked as an intangible asset; paying less is a
+// gain. It returns the goodwill.
+func (c *Company) absorb(target string, m merger) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	net := 0
+	for a, v := range m.balances {
+		switch ledgerAccounts[a] {
+		case assetAccount:
+			c.book(a, InvestmentsAccount, v, "merged "+target)
+			net += v
+		case liabilityAccount:
+			c.book(InvestmentsAccount, a, v, "merged "+target)
+			net -= v
+		}
+	}
+	goodwill := m.cost - net
+	if goodwill >= 0 {
+		c.book(IntangibleAssetsAccount, InvestmentsAccount, goodwill, "goodwill on "+target)
+	} else {
+		c.book(InvestmentsAccount, NonOperatingRevenueAccount, -goodwill, "bargain purchase of "+target)
+	}
+
+	for _, industry := range m.industries {
+		if !c.Industries.IsPrimary(industry) {
+			c.Industries.PrimaryIndustries = append(c.Industries.PrimaryIndustries, industry)
+		}
+	}
+	if c.Industries.Capacity == nil {
+		c.Industries.Capacity = map[Industry]int{}
+	}
+	for industry, units := range m.capacity {
+		c.Industries.Capacity[industry] += units
+	}
+	c.Employment.Employees.Value += m.employees
+	c.invoicesPayable += m.payable
+	c.invoicesReceivable += m.receivable
+	lines := map[LedgerAccount]*bank.CurrencyValue{
+		OperatingRevenueAccount:       &c.Income.OperatingRevenue,
+		NonOperatingRevenueAccount:    &c.Income.NonOperatingRevenue,
+		ProductionExpensesAccount:     &c.Income.ProductionExpenses,
+		AdministrativeExpensesAccount: &c.Income.AdministrativeExpenses,
+		DepreciationAccount:           &c.Income.Depreciation,
+	}
+	for a, v := range lines {
+		sum, err := bank.Convert(v.Currency, bank.Minor, v.Unit, m.income[a])
+		if err != nil {
+			log.Println(err)
+			continue
+		}
+		v.Value += sum
+	}
+	c.BalanceSheet.sync(c.ledger)
+	return goodwill
+}
+
+func (w *World) publishTender(t *tender, status string, day int, update payloads.TenderUpdate) {
+	update.Acquirer = t.offer.Acquirer
+	update.Target = t.offer.Target
+	update.Status = status
+	update.Day = day
+	update.Consideration = t.offer.Consideration
+	update.CurrencyCode = t.target.DefaultCurrency
+	update.CurrencyUnit = bank.Minor
+	update.Price = t.price
+	update.Premium = t.offer.Premium
+	update.Expiry = t.expiry
+	update.AcquirerCurrency = t.acquirer.DefaultCurrency
+	if err := w.nc.Publish(subjects.Tender(t.target.Code), update); err != nil {
+		fmt.Println(err)
+	}
+}
@@ -0,0 +1,67 @@
+package world
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+
+	"github.com/jxlxx/GreenIsland/payloads"
+)
+
+func TestTenderAccepted(t *testing.T) {
+	tests := []struct {
+		name     string
+		accepted int
+		total    int
+		expected bool
+	}{
+		{"over the threshold", 600, 1000, true},
+		{"on the threshold", 500, 1000, true},
+		{"under the threshold", 499, 1000, false},
+		{"nobody accepted", 0, 1000, false},
+		{"no shares", 0, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tenderAccepted(tt.accepted, tt.total, 5000); got != tt.expected {
+				t.Errorf("expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestAcceptNeedsOpenOffer(t *testing.T) {
+	target := &Company{Code: "TGT", id: uuid.New()}
+	acquirer := &Company{Code: "ACQ", id: uuid.New()}
+	tests := []struct {
+		name   string
+		price  int
+		closed bool
+		holder uuid.UUID
+	}{
+		{"not announced", 0, false, uuid.New()},
+		{"closed", 100, true, uuid.New()},
+		{"target's own shares", 100, false, target.id},
+		{"acquirer's shares", 100, false, acquirer.id},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := &World{}
+			offer := &tender{
+				offer:    payloads.TenderOffer{Acquirer: "ACQ", Target: "TGT"},
+				acquirer: acquirer,
+				target:   target,
+				price:    tt.price,
+				closed:   tt.closed,
+				accepted: map[uuid.UUID]int{},
+			}
+			shares, err := w.accept(offer, payloads.TenderAcceptance{Target: "TGT", Holder: tt.holder, Shares: 10})
+			if err == nil || shares != 0 {
+				t.Errorf("expected no shares accepted and an error, got %d, %v", shares, err)
+			}
+			if len(offer.accepted) != 0 {
+				t.Errorf("expected no acceptances, got %v", offer.accepted)
+			}
+		})
+	}
+}
@@ -0,0 +1,213 @@
+package world
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/nats-io/nats.go"
+
+	"github.com/jxlxx/GreenIsland/bank"
+)
+
+func money(code bank.CurrencyCode, minor int) bank.CurrencyValue {
+	return bank.CurrencyValue{
+		Currency: code,
+		Unit:     bank.Minor,
+		Value:    minor,
+	}
+}
+
+func toMinor(v bank.CurrencyValue) int {
+	minor, err := v.Convert(bank.Minor)
+	if err != nil {
+		log.Println(err)
+		return 0
+	}
+	return minor
+}
+
+// toMicro keeps micro values as they are, since converting them through
+// minor units would round them away.
+func toMicro(v bank.CurrencyValue) int {
+	if v.Unit == bank.Micro {
+		return v.Value
+	}
+	micro, err := bank.Convert(v.Currency, v.Unit, bank.Micro, v.Value)
+	if err != nil {
+		log.Println(err)
+		return 0
+	}
+	return micro
+}
+
+// proportion returns part/whole of v without overflowing on large sums.
+func proportion(v, part, whole int) int {
+	if whole == 0 {
+		return 0
+	}
+	return int(float64(v) * float64(part) / float64(whole))
+}
+
+// bankRetries is how many times a payment is sent to a bank before giving
+// up on hearing back.
+const bankRetries = 3
+
+// errUnconfirmed means a bank never said whether it made a payment.
+var errUnconfirmed = errors.New("err: payment not confirmed by the bank")
+
+// deposit pays money into an account. Depositing nothing does nothing.
+func deposit(nc *nats.EncodedConn, to bank.AccountRef, v bank.CurrencyValue) error {
+	if v.Value == 0 {
+		return nil
+	}
+	req := bank.Deposit{
+		AccountID: to.AccountID,
+		Currency:  v.Currency,
+		Unit:      v.Unit,
+		Sum:       v.Value,
+		Reference: uuid.New(),
+	}
+	return confirm(nc, bank.AdminSubject(to.CountryCode, to.BankCode, "deposit"), req)
+}
+
+// withdraw takes money out of an account. Withdrawing nothing does nothing.
+func withdraw(nc *nats.EncodedConn, from bank.AccountRef, v bank.CurrencyValue) error {
+	if v.Value == 0 {
+		return nil
+	}
+	req := bank.Withdrawal{
+		AccountID: from.AccountID,
+		Currency:  v.Currency,
+		Unit:      v.Unit,
+		Sum:       v.Value,
+		Reference: uuid.New(),
+	}
+	return confirm(nc, bank.AdminSubject(from.CountryCode, from.BankCode, "withdraw"), req)
+}
+
+// pay moves money between two accounts, which may be held at different
+// banks.
+func pay(nc *nats.EncodedConn, from, to bank.AccountRef, v bank.CurrencyValue) error {
+	return transfer(nc, from, to, v, v)
+}
+
+// transfer moves money between two accounts, paying out in one currency and
+// in in another. Within a bank the bank moves it in one request. Between
+// banks it is withdrawn and then deposited, each confirmed by its bank
+// before going on, and the payer is refunded if the receiving bank refuses
+// the deposit. If the world stops between the two, the money has left the
+// payer and not reached the payee; the payer's bank keeps the withdrawal's
+// reference.
+func transfer(nc *nats.EncodedConn, from, to bank.AccountRef, out, in bank.CurrencyValue) error {
+	if from.SameBank(to) && out == in {
+		if out.Value == 0 {
+			return nil
+		}
+		req := bank.Transfer{
+			From:      from.AccountID,
+			To:        to.AccountID,
+			Currency:  out.Currency,
+			Unit:      out.Unit,
+			Sum:       out.Value,
+			Reference: uuid.New(),
+		}
+		return confirm(nc, bank.AdminSubject(from.CountryCode, from.BankCode, "transfer"), req)
+	}
+	if err := withdraw(nc, from, out); err != nil {
+		return err
+	}
+	if err := deposit(nc, to, in); err != nil {
+		if err := deposit(nc, from, out); err != nil {
+			log.Println(err)
+		}
+		return err
+	}
+	return nil
+}
+
+// confirm sends a payment until its bank says whether it made it, with the
+// same reference every time so that it is made only once. A bank that does
+// not answer holds the payment up until it does.
+func confirm(nc *nats.EncodedConn, subject string, req any) error {
+	err := bankRequest(nc, subject, req)
+	for errors.Is(err, errUnconfirmed) {
+		log.Println(err)
+		time.Sleep(time.Second)
+		err = bankRequest(nc, subject, req)
+	}
+	return err
+}
+
+// balance asks a bank how much of a currency an account holds, in minor
+// units.
+func balance(nc *nats.EncodedConn, ref bank.AccountRef, code bank.CurrencyCode) (int, error) {
+	subject := bank.Subject(ref.CountryCode, ref.BankCode, "account")
+	resp := bank.AccountResponse{}
+	if err := nc.Request(subject, bank.AccountRequest{AccountID: ref.AccountID}, &resp, time.Second); err != nil {
+		return 0, err
+	}
+	if resp.Status != "OK" {
+		return 0, fmt.Errorf("%s: no account %s", subject, ref.AccountID)
+	}
+	return resp.Account.Funds[code].TotalMinor, nil
+}
+
+// openAccount opens a new account for owner at a bank.
+func openAccount(nc *nats.EncodedConn, countryCode, bankCode string, owner uuid.UUID) (bank.AccountRef, error) {
+	subject := bank.Subject(countryCode, bankCode, "create")
+	resp := bank.AccountResponse{}
+	if err := nc.Request(subject, bank.NewAccountPayload{UserID: owner}, &resp, time.Second); err != nil {
+		return bank.AccountRef{}, err
+	}
+	if resp.Status != "OK" {
+		return bank.AccountRef{}, fmt.Errorf("%s: account not opened", subject)
+	}
+	return bank.AccountRef{
+		CountryCode: countryCode,
+		BankCode:    bankCode,
+		AccountID:   resp.Account.AccountID,
+	}, nil
+}
+
+// bankRequest sends a payment to a bank, and sends it again while the bank
+// does not answer or is still applying it. Payments carry a reference, so the
+// bank applies each only once. A payment the bank applied but could not
+// record as applied has still been made.
+func bankRequest(nc *nats.EncodedConn, subject string, req any) error {
+	return bankReply(nc, subject, req, nil)
+}
+
+// bankReply is bankRequest for requests whose answer is wanted. It is
+// decoded into resp if resp is not nil.
+func bankReply(nc *nats.EncodedConn, subject string, req, resp any) error {
+	for i := 0; i < bankRetries; i++ {
+		msg := nats.Msg{}
+		err := nc.Request(subject, req, &msg, time.Second)
+		if errors.Is(err, nats.ErrTimeout) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		status := bank.Response{}
+		if err := json.Unmarshal(msg.Data, &status); err != nil {
+			return err
+		}
+		switch status.Status {
+		case "Pending":
+			time.Sleep(100 * time.Millisecond)
+			continue
+		case "Error":
+			return fmt.Errorf("%s: %s", subject, status.Message)
+		}
+		if resp == nil {
+			return nil
+		}
+		return json.Unmarshal(msg.Data, resp)
+	}
+	return fmt.Errorf("%s: %w", subject, errUnconfirmed)
+}
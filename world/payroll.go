@@ -0,0 +1,77 @@
+package world
+
+import (
+	"fmt"
+
+	"github.com/jxlxx/GreenIsland/bank"
+	"github.com/jxlxx/GreenIsland/payloads"
+	"github.com/jxlxx/GreenIsland/subjects"
+)
+
+const (
+	daysPerYear = daysPerQuarter * 4
+	daysPerWeek = 7
+)
+
+// businessDay is false on the last two days of every week.
+func businessDay(day int) bool {
+	return day%daysPerWeek < 5
+}
+
+// dailyWages is a day of salary for every employee, in minor units.
+func (c *Company) dailyWages() int {
+	e := c.Employment
+	return e.Employees.Value * toMinor(e.AverageAnnualSalary) / daysPerYear
+}
+
+// payrollDue reports whether wages are paid on day: the first business day
+// once PayrollDays have passed since the last payday. The first payday is
+// PayrollDays after the first day seen. The caller holds c.mu.
+func (c *Company) payrollDue(day int) bool {
+	if c.Employment.PayrollDays <= 0 {
+		return false
+	}
+	if c.payday == 0 {
+		c.payday = day + c.Employment.PayrollDays
+	}
+	if day < c.payday || !businessDay(day) {
+		return false
+	}
+	c.payday = day + c.Employment.PayrollDays
+	return true
+}
+
+// payrollDay accrues the day's wages and, every PayrollDays on the first
+// business day, pays everything owed to the households of the home country.
+// The caller holds c.mu, which is let go while the wages are paid.
+func (c *Company) payrollDay(day int) {
+	c.book(WagesAccount, WagesPayableAccount, c.dailyWages(), "wages accrued")
+	if c.country == nil || !c.payrollDue(day) {
+		return
+	}
+
+	owed := c.ledger.Balance(WagesPayableAccount)
+	update := payloads.PayrollUpdate{
+		Company:      c.Code,
+		Day:          day,
+		Employees:    c.Employment.Employees.Value,
+		CurrencyCode: c.DefaultCurrency,
+		CurrencyUnit: bank.Minor,
+		Amount:       owed,
+		Status:       "paid",
+	}
+	var err error
+	c.unlocked(func() { err = pay(c.nc, c.account, c.country.households, money(c.DefaultCurrency, owed)) })
+	if err != nil {
+		update.Status = "failed"
+		update.Error = err.Error()
+		c.missedPayrolls++
+	} else {
+		c.book(WagesPayableAccount, LiquidAssetsAccount, owed, "payroll")
+		c.BalanceSheet.sync(c.ledger)
+		c.missedPayrolls = 0
+	}
+	if err := c.nc.Publish(subjects.Payroll(c.Code), update); err != nil {
+		fmt.Println(err)
+	}
+}
@@ -0,0 +1,58 @@
+package world
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestDailyWages(t *testing.T) {
+	tests := []struct {
+		name      string
+		employees int
+		salary    int
+		expected  int
+	}{
+		{"whole days", 100, 3600000, 1000000},
+		{"rounds down", 1, 100000, 277},
+		{"nobody employed", 0, 3600000, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &Company{}
+			c.Employment.Employees.Value = tt.employees
+			c.Employment.AverageAnnualSalary = money("USD", tt.salary)
+			if got := c.dailyWages(); got != tt.expected {
+				t.Errorf("expected %d, got %d", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestPayrollDue(t *testing.T) {
+	tests := []struct {
+		name     string
+		days     int
+		first    int
+		last     int
+		expected []int
+	}{
+		{"fortnightly", 14, 1, 50, []int{15, 29, 43}},
+		{"moved off the weekend", 14, 6, 40, []int{21, 35}},
+		{"no payroll", 0, 1, 50, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &Company{}
+			c.Employment.PayrollDays = tt.days
+			var got []int
+			for day := tt.first; day <= tt.last; day++ {
+				if c.payrollDue(day) {
+					got = append(got, day)
+				}
+			}
+			if !slices.Equal(got, tt.expected) {
+				t.Errorf("expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,177 @@
+package world
+
+import (
+	"log"
+
+	"github.com/jxlxx/GreenIsland/bank"
+	"github.com/jxlxx/GreenIsland/payloads"
+	"github.com/jxlxx/GreenIsland/types"
+)
+
+// Population is broken down into age cohorts. Birth and death rates are per
+// 100,000 people per year, Unemployment is in basis points and AverageWage is
+// annual. MigrationRate is the share of the working population, in basis
+// points per quarter, that leaves for a country that is better on every count.
+type Population struct {
+	Cohorts       []Cohort           `yaml:"cohorts"`
+	BirthRate     int                `yaml:"birth_rate"`
+	Unemployment  types.Value        `yaml:"unemployment"`
+	AverageWage   bank.CurrencyValue `yaml:"average_wage"`
+	MigrationRate int                `yaml:"migration_rate"`
+
+	births    int
+	deaths    int
+	migration int
+}
+
+type Cohort struct {
+	MinAge     int  `yaml:"min_age"`
+	MaxAge     int  `yaml:"max_age"`
+	Population int  `yaml:"population"`
+	DeathRate  int  `yaml:"death_rate"`
+	Working    bool `yaml:"working"`
+}
+
+func (p *Population) Total() int {
+	sum := 0
+	for _, c := range p.Cohorts {
+		sum += c.Population
+	}
+	return sum
+}
+
+func (p *Population) Working() int {
+	sum := 0
+	for _, c := range p.Cohorts {
+		if c.Working {
+			sum += c.Population
+		}
+	}
+	return sum
+}
+
+// Age runs one year of births, deaths and ageing. Each year the oldest
+// 1/width of a cohort moves up into the next one.
+func (p *Population) Age() {
+	if len(p.Cohorts) == 0 {
+		return
+	}
+	births := p.Total() * p.BirthRate / 100000
+	for i := range p.Cohorts {
+		deaths := p.Cohorts[i].Population * p.Cohorts[i].DeathRate / 100000
+		p.Cohorts[i].Population -= deaths
+		p.deaths += deaths
+	}
+	for i := len(p.Cohorts) - 2; i >= 0; i-- {
+		c := &p.Cohorts[i]
+		moving := c.Population / (c.MaxAge - c.MinAge + 1)
+		c.Population -= moving
+		p.Cohorts[i+1].Population += moving
+	}
+	p.Cohorts[0].Population += births
+	p.births += births
+}
+
+// migrate moves people into (or, when negative, out of) the working cohorts
+// in proportion to their size. No more than the working population can leave
+// and no cohort drops below zero. It returns how many moved.
+func (p *Population) migrate(people int) int {
+	working := p.Working()
+	if working == 0 {
+		return 0
+	}
+	people = max(people, -working)
+	moved := 0
+	for i := range p.Cohorts {
+		c := &p.Cohorts[i]
+		if c.Working {
+			n := max(-c.Population, proportion(people, c.Population, working))
+			c.Population += n
+			moved += n
+		}
+	}
+	p.migration += moved
+	return moved
+}
+
+func (p *Population) Update() {
+	p.Unemployment.Value = max(0, p.Unemployment.Value+p.Unemployment.CalcUpdate())
+	p.AverageWage.Value += p.AverageWage.CalcUpdate()
+}
+
+// report summarises the quarter and starts counting the next one.
+func (p *Population) report() payloads.Demographics {
+	d := payloads.Demographics{
+		Births:       p.births,
+		Deaths:       p.deaths,
+		NetMigration: p.migration,
+		Unemployment: p.Unemployment.Value,
+	}
+	for _, c := range p.Cohorts {
+		d.Cohorts = append(d.Cohorts, payloads.Cohort{
+			MinAge:     c.MinAge,
+			MaxAge:     c.MaxAge,
+			Population: c.Population,
+		})
+	}
+	p.births, p.deaths, p.migration = 0, 0, 0
+	return d
+}
+
+type migrationProfile struct {
+	country      *Country
+	working      int
+	unemployment int
+	wage         int
+	rate         int
+}
+
+func (w *World) migrationProfile(c *Country, hour int) migrationProfile {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	wage, err := w.fx.Convert(c.Population.AverageWage, w.fx.Base, hour)
+	if err != nil {
+		log.Println(err)
+	}
+	return migrationProfile{
+		country:      c,
+		working:      c.Population.Working(),
+		unemployment: c.Population.Unemployment.Value,
+		wage:         wage.Value,
+		rate:         c.Population.MigrationRate,
+	}
+}
+
+// MigrationSubscriber moves working people each quarter from every country
+// to each country with higher wages or lower unemployment. Only those who
+// actually left a country arrive in the other.
+func (w *World) MigrationSubscriber() func(payloads.WorldTick) {
+	return func(p payloads.WorldTick) {
+		profiles := []migrationProfile{}
+		for _, c := range w.countries {
+			profiles = append(profiles, w.migrationProfile(c, p.EGT))
+		}
+		for _, from := range profiles {
+			for _, to := range profiles {
+				if from.country == to.country || from.wage == 0 {
+					continue
+				}
+				pull := float64(to.wage-from.wage)/float64(from.wage) +
+					float64(from.unemployment-to.unemployment)/10000
+				if pull <= 0 {
+					continue
+				}
+				people := int(float64(from.working) * float64(from.rate) / 10000 * pull)
+				if people == 0 {
+					continue
+				}
+				from.country.mu.Lock()
+				left := -from.country.Population.migrate(-people)
+				from.country.mu.Unlock()
+				to.country.mu.Lock()
+				to.country.Population.migrate(left)
+				to.country.mu.Unlock()
+			}
+		}
+	}
+}
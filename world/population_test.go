@@ -0,0 +1,94 @@
+package world
+
+import "testing"
+
+func TestPopulationAge(t *testing.T) {
+	tests := []struct {
+		name      string
+		birthRate int
+		cohorts   []Cohort
+		expected  []int
+	}{
+		{
+			name:     "no cohorts",
+			expected: nil,
+		},
+		{
+			name:      "oldest slice moves up",
+			birthRate: 0,
+			cohorts: []Cohort{
+				{MinAge: 0, MaxAge: 9, Population: 1000},
+				{MinAge: 10, MaxAge: 19, Population: 1000},
+				{MinAge: 20, MaxAge: 99, Population: 1000},
+			},
+			expected: []int{900, 1000, 1100},
+		},
+		{
+			name:      "births join the youngest",
+			birthRate: 1000,
+			cohorts: []Cohort{
+				{MinAge: 0, MaxAge: 9, Population: 1000},
+				{MinAge: 10, MaxAge: 99, Population: 1000},
+			},
+			expected: []int{920, 1100},
+		},
+		{
+			name:      "deaths before ageing",
+			birthRate: 0,
+			cohorts: []Cohort{
+				{MinAge: 0, MaxAge: 9, Population: 1000, DeathRate: 10000},
+				{MinAge: 10, MaxAge: 99, Population: 1000, DeathRate: 50000},
+			},
+			expected: []int{810, 590},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &Population{BirthRate: tt.birthRate, Cohorts: tt.cohorts}
+			p.Age()
+			for i, c := range p.Cohorts {
+				if c.Population != tt.expected[i] {
+					t.Errorf("cohort %d: expected %d, got %d", i, tt.expected[i], c.Population)
+				}
+			}
+		})
+	}
+}
+
+func TestPopulationMigrate(t *testing.T) {
+	cohorts := func() []Cohort {
+		return []Cohort{
+			{Population: 500},
+			{Population: 300, Working: true},
+			{Population: 100, Working: true},
+			{Population: 200},
+		}
+	}
+	tests := []struct {
+		name     string
+		people   int
+		moved    int
+		expected []int
+	}{
+		{"arrivals", 400, 400, []int{500, 600, 200, 200}},
+		{"departures", -200, -200, []int{500, 150, 50, 200}},
+		{"everyone working leaves", -400, -400, []int{500, 0, 0, 200}},
+		{"no more than the working population", -1000, -400, []int{500, 0, 0, 200}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &Population{Cohorts: cohorts()}
+			if moved := p.migrate(tt.people); moved != tt.moved {
+				t.Errorf("expected %d moved, got %d", tt.moved, moved)
+			}
+			for i, c := range p.Cohorts {
+				if c.Population != tt.expected[i] {
+					t.Errorf("cohort %d: expected %d, got %d", i, tt.expected[i], c.Population)
+				}
+			}
+			if d := p.report(); d.NetMigration != tt.moved {
+				t.Errorf("expected net migration %d, got %d", tt.moved, d.NetMigration)
+			}
+		})
+	}
+}
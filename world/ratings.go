@@ -0,0 +1,221 @@
+package world
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/micro"
+
+	"github.com/jxlxx/GreenIsland/config"
+	"github.com/jxlxx/GreenIsland/payloads"
+	"github.com/jxlxx/GreenIsland/subjects"
+)
+
+// ratingGrades run from the best credit to the worst. A company that has
+// missed a loan payment is in default and rated D.
+var ratingGrades = []string{"AAA", "AA", "A", "BBB", "BB", "B", "CCC", "CC", "C"}
+
+const defaultGrade = "D"
+
+// Each ratio is graded by the first threshold it meets, in ratingGrades
+// order, and gets the lowest grade if it meets none. Leverage is debt to
+// equity in basis points and must be at or below the threshold. Coverage is
+// how many hundredths of times earnings before interest cover interest and
+// liquidity is current assets to current liabilities in basis points; both
+// must be at or above it.
+var (
+	leverageGrades  = []int{1000, 2500, 5000, 7500, 10000, 15000, 20000, 30000}
+	coverageGrades  = []int{1500, 1000, 600, 400, 250, 150, 100, 50}
+	liquidityGrades = []int{25000, 20000, 15000, 12500, 10000, 8000, 6000, 4000}
+)
+
+var (
+	currentAssets = []LedgerAccount{
+		LiquidAssetsAccount,
+		MarketableSecuritiesAccount,
+		AccountsReceivablesAccount,
+		InventoryAccount,
+		PrepaidExpensesAccount,
+	}
+	currentLiabilities = []LedgerAccount{
+		AccountsPayableAccount,
+		WagesPayableAccount,
+		InterestPayableAccount,
+		DeferredRevenueAccount,
+		ShortTermDebtsAccount,
+		DividendsPayableAccount,
+	}
+)
+
+// creditRatios are what a company is rated on. A company without debt or
+// interest has no leverage and unlimited coverage.
+func (c *Company) creditRatios() payloads.CreditRatios {
+	l := c.ledger
+	r := payloads.CreditRatios{Coverage: math.MaxInt32}
+	debt := l.Balance(ShortTermDebtsAccount) + l.Balance(LongTermDebtsAccount)
+	if equity := l.Equity(); equity > 0 {
+		r.Leverage = proportion(debt, 10000, equity)
+	} else {
+		r.Leverage = math.MaxInt32
+	}
+	if interest := c.quarterlyInterest(); interest > 0 {
+		r.Coverage = proportion(c.runRateEarnings()+interest, 100, interest)
+	}
+	assets, liabilities := 0, 0
+	for _, a := range currentAssets {
+		assets += l.Balance(a)
+	}
+	for _, a := range currentLiabilities {
+		liabilities += l.Balance(a)
+	}
+	r.Liquidity = math.MaxInt32
+	if liabilities > 0 {
+		r.Liquidity = proportion(assets, 10000, liabilities)
+	}
+	return r
+}
+
+func grade(v int, thresholds []int, atMost bool) int {
+	for i, t := range thresholds {
+		if (atMost && v <= t) || (!atMost && v >= t) {
+			return i
+		}
+	}
+	return len(thresholds)
+}
+
+// rate grades the company's credit from the average grade of its ratios,
+// rounded down to the worse grade.
+func rate(r payloads.CreditRatios) string {
+	sum := grade(r.Leverage, leverageGrades, true) +
+		grade(r.Coverage, coverageGrades, false) +
+		grade(r.Liquidity, liquidityGrades, false)
+	return ratingGrades[min((sum+2)/3, len(ratingGrades)-1)]
+}
+
+// creditRating grades the company on its ratios, or as in default if it has
+// missed a loan payment. The caller holds c.mu.
+func (c *Company) creditRating(r payloads.CreditRatios) string {
+	if c.missedLoanPayments > 0 {
+		return defaultGrade
+	}
+	return rate(r)
+}
+
+// rerate rates the company again and reports its previous rating. The
+// caller holds c.mu.
+func (c *Company) rerate() (payloads.RatingUpdate, string) {
+	update := payloads.RatingUpdate{
+		Company: c.Code,
+		Ratios:  c.creditRatios(),
+	}
+	update.Rating = c.creditRating(update.Ratios)
+	previous := c.rating
+	c.rating = update.Rating
+	return update, previous
+}
+
+// ratingAction compares two ratings. An empty previous rating is a new one.
+func ratingAction(rating, previous string) string {
+	rank := func(r string) int {
+		for i, g := range ratingGrades {
+			if g == r {
+				return i
+			}
+		}
+		return len(ratingGrades)
+	}
+	switch {
+	case previous == "":
+		return "assigned"
+	case rank(rating) < rank(previous):
+		return "upgrade"
+	case rank(rating) > rank(previous):
+		return "downgrade"
+	}
+	return "affirmed"
+}
+
+// RatingSubscriber rates every company at the end of the quarter and
+// publishes new ratings, upgrades and downgrades.
+func (w *World) RatingSubscriber() func(payloads.WorldTick) {
+	return func(p payloads.WorldTick) {
+		w.mu.Lock()
+		companies := w.companies
+		w.mu.Unlock()
+		for _, c := range companies {
+			update, ok := c.quarterlyRating(p.Quarter)
+			if !ok || update.Action == "affirmed" {
+				continue
+			}
+			if err := w.nc.Publish(subjects.Rating(update.Company), update); err != nil {
+				fmt.Println(err)
+			}
+		}
+	}
+}
+
+func (c *Company) quarterlyRating(quarter int) (payloads.RatingUpdate, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return payloads.RatingUpdate{}, false
+	}
+	update, previous := c.rerate()
+	update.Quarter = quarter
+	update.Previous = previous
+	update.Action = ratingAction(update.Rating, previous)
+	return update, true
+}
+
+func (c *Company) currentRating() payloads.RatingUpdate {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return payloads.RatingUpdate{
+		Company: c.Code,
+		Rating:  c.rating,
+		Ratios:  c.creditRatios(),
+	}
+}
+
+// CompanyRating answers with a company's current rating and the ratios
+// behind it.
+func (w *World) CompanyRating(req micro.Request) {
+	r := payloads.RatingRequest{}
+	if err := json.Unmarshal(req.Data(), &r); err != nil {
+		respondError(req, "cannot parse request")
+		return
+	}
+	w.mu.Lock()
+	companies := w.companies
+	w.mu.Unlock()
+	for _, c := range companies {
+		if c.Code != r.Code {
+			continue
+		}
+		if err := req.RespondJSON(c.currentRating()); err != nil {
+			log.Println(err)
+		}
+		return
+	}
+	respondError(req, fmt.Sprintf("no company %s", r.Code))
+}
+
+func (w *World) RatingService(nc *nats.Conn) micro.Service {
+	conf := micro.Config{
+		Name:        "RatingService",
+		Version:     config.GetEnvOrDefault("VERSION", "0.0.1"),
+		Description: "Credit ratings for every company.",
+	}
+	srv, err := micro.AddService(nc, conf)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	if err := srv.AddGroup("ratings").AddEndpoint("company", micro.HandlerFunc(w.CompanyRating)); err != nil {
+		log.Fatalln(err)
+	}
+	return srv
+}
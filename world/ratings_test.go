@@ -0,0 +1,75 @@
+package world
+
+import (
+	"math"
+	"testing"
+
+	"github.com/jxlxx/GreenIsland/payloads"
+)
+
+func TestGrade(t *testing.T) {
+	tests := []struct {
+		name       string
+		v          int
+		thresholds []int
+		atMost     bool
+		expected   int
+	}{
+		{"low leverage", 500, leverageGrades, true, 0},
+		{"leverage on threshold", 1000, leverageGrades, true, 0},
+		{"leverage just over", 1001, leverageGrades, true, 1},
+		{"leverage beyond every grade", 40000, leverageGrades, true, len(leverageGrades)},
+		{"high coverage", 2000, coverageGrades, false, 0},
+		{"coverage on threshold", 400, coverageGrades, false, 3},
+		{"coverage just under", 399, coverageGrades, false, 4},
+		{"no coverage", 0, coverageGrades, false, len(coverageGrades)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := grade(tt.v, tt.thresholds, tt.atMost); got != tt.expected {
+				t.Errorf("expected %d, got %d", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestRate(t *testing.T) {
+	tests := []struct {
+		name     string
+		ratios   payloads.CreditRatios
+		expected string
+	}{
+		{
+			name:     "no debt",
+			ratios:   payloads.CreditRatios{Leverage: 0, Coverage: math.MaxInt32, Liquidity: math.MaxInt32},
+			expected: "AAA",
+		},
+		{
+			name:     "rounded down",
+			ratios:   payloads.CreditRatios{Leverage: 500, Coverage: 2000, Liquidity: 20000},
+			expected: "AA",
+		},
+		{
+			name:     "middling",
+			ratios:   payloads.CreditRatios{Leverage: 7500, Coverage: 400, Liquidity: 12500},
+			expected: "BBB",
+		},
+		{
+			name:     "one bad ratio",
+			ratios:   payloads.CreditRatios{Leverage: 500, Coverage: 0, Liquidity: 25000},
+			expected: "BBB",
+		},
+		{
+			name:     "insolvent",
+			ratios:   payloads.CreditRatios{Leverage: math.MaxInt32, Coverage: 0, Liquidity: 0},
+			expected: "C",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := rate(tt.ratios); got != tt.expected {
+				t.Errorf("expected %s, got %s", tt.expected, got)
+			}
+		})
+	}
+}
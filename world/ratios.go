@@ -0,0 +1,75 @@
+package world
+
+import (
+	"log"
+
+	"github.com/jxlxx/GreenIsland/bank"
+	"github.com/jxlxx/GreenIsland/payloads"
+)
+
+// normalizer puts figures from an update in micro units so that figures
+// reported in different units can be compared.
+type normalizer struct {
+	code bank.CurrencyCode
+}
+
+func (n normalizer) micro(unit bank.UnitType, v int) float64 {
+	sum, err := bank.Convert(n.code, unit, bank.Micro, v)
+	if err != nil {
+		log.Println(err)
+		return 0
+	}
+	return float64(sum)
+}
+
+func ratio(part, whole float64) float64 {
+	if whole == 0 {
+		return 0
+	}
+	return part / whole
+}
+
+// CreateRatios works out the update's financial ratios. Returns on equity
+// and assets, the price to earnings ratio and the dividend yield are
+// annualized from the quarter. Prices are taken halfway between bid and ask.
+// A company that is losing money has no price to earnings or payout ratio.
+func CreateRatios(u payloads.QuarterlyCompanyUpdate) payloads.Ratios {
+	n := normalizer{code: u.CurrencyCode}
+	a, l, e := u.BalanceSheet.Assets, u.BalanceSheet.Liabilities, u.BalanceSheet.Equity
+	i := u.IncomeSheet
+	asset := func(v int) float64 { return n.micro(a.CurrencyUnit, v) }
+	liability := func(v int) float64 { return n.micro(l.CurrencyUnit, v) }
+	income := func(v int) float64 { return n.micro(i.CurrencyUnit, v) }
+
+	quick := asset(a.Liquid) + asset(a.ForeignCash) + asset(a.MarketableSecurities) + asset(a.AccountsReceivables)
+	current := quick + asset(a.Inventory) + asset(a.PrepaidExpenses)
+	totalAssets := current + asset(a.CapitalAssets) + asset(a.IntangibleAssets) + asset(a.Investments)
+	currentLiabilities := liability(l.AccountsPayable) + liability(l.WagesPayable) + liability(l.InterestPayable) +
+		liability(l.DeferredRevenue) + liability(l.ShortTermDebts) + liability(l.DividendsPayable)
+	debt := liability(l.ShortTermDebts) + liability(l.LongTermDebts)
+	equity := n.micro(e.CurrencyUnit, e.Total)
+
+	revenue := income(i.OperatingRevenue) + income(i.Exports)
+	netIncome := income(i.NetIncome)
+	eps := n.micro(u.PerShare.CurrencyUnit, u.PerShare.EPS)
+	dividend := n.micro(u.Dividends.CurrencyUnit, u.Dividends.Payout)
+	price := n.micro(u.Quote.CurrencyUnit, u.Quote.Bid+u.Quote.Ask) / 2
+	priceEarnings, payoutRatio := 0.0, 0.0
+	if eps > 0 {
+		priceEarnings = ratio(price, 4*eps)
+		payoutRatio = ratio(dividend, eps)
+	}
+
+	return payloads.Ratios{
+		CurrentRatio:   ratio(current, currentLiabilities),
+		QuickRatio:     ratio(quick, currentLiabilities),
+		DebtToEquity:   ratio(debt, equity),
+		GrossMargin:    ratio(revenue-income(i.ProductionExpenses), revenue),
+		NetMargin:      ratio(netIncome, revenue),
+		ReturnOnEquity: ratio(4*netIncome, equity),
+		ReturnOnAssets: ratio(4*netIncome, totalAssets),
+		PriceEarnings:  priceEarnings,
+		DividendYield:  ratio(4*dividend, price),
+		PayoutRatio:    payoutRatio,
+	}
+}
@@ -0,0 +1,100 @@
+package world
+
+import (
+	"math"
+	"testing"
+
+	"github.com/jxlxx/GreenIsland/bank"
+	"github.com/jxlxx/GreenIsland/payloads"
+)
+
+func TestCreateRatios(t *testing.T) {
+	update := func(netIncome, eps int) payloads.QuarterlyCompanyUpdate {
+		return payloads.QuarterlyCompanyUpdate{
+			CurrencyCode: "USD",
+			BalanceSheet: payloads.BalanceSheet{
+				Assets: payloads.Assets{
+					CurrencyUnit:        bank.Major,
+					Liquid:              200,
+					AccountsReceivables: 100,
+					Inventory:           100,
+					CapitalAssets:       600,
+				},
+				Liabilities: payloads.Liabilities{
+					CurrencyUnit:    bank.Major,
+					AccountsPayable: 200,
+					LongTermDebts:   300,
+				},
+				Equity: payloads.Equity{CurrencyUnit: bank.Major, Total: 500},
+			},
+			IncomeSheet: payloads.Income{
+				CurrencyUnit:       bank.Minor,
+				OperatingRevenue:   40000,
+				ProductionExpenses: 30000,
+				NetIncome:          netIncome,
+			},
+			Dividends: payloads.Dividends{CurrencyUnit: bank.Micro, Payout: 5000},
+			PerShare:  payloads.PerShare{CurrencyUnit: bank.Micro, EPS: eps},
+			Quote:     payloads.Quote{CurrencyUnit: bank.Minor, Bid: 1900, Ask: 2100},
+		}
+	}
+	tests := []struct {
+		name     string
+		update   payloads.QuarterlyCompanyUpdate
+		expected payloads.Ratios
+	}{
+		{
+			name:   "profitable",
+			update: update(5000, 10000),
+			expected: payloads.Ratios{
+				CurrentRatio:   2,
+				QuickRatio:     1.5,
+				DebtToEquity:   0.6,
+				GrossMargin:    0.25,
+				NetMargin:      0.125,
+				ReturnOnEquity: 0.4,
+				ReturnOnAssets: 0.2,
+				PriceEarnings:  5,
+				DividendYield:  0.1,
+				PayoutRatio:    0.5,
+			},
+		},
+		{
+			name:   "loss making",
+			update: update(-5000, -10000),
+			expected: payloads.Ratios{
+				CurrentRatio:   2,
+				QuickRatio:     1.5,
+				DebtToEquity:   0.6,
+				GrossMargin:    0.25,
+				NetMargin:      -0.125,
+				ReturnOnEquity: -0.4,
+				ReturnOnAssets: -0.2,
+				PriceEarnings:  0,
+				DividendYield:  0.1,
+				PayoutRatio:    0,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := CreateRatios(tt.update)
+			check := func(name string, expected, got float64) {
+				if math.Abs(expected-got) > 1e-9 {
+					t.Errorf("expected %s %g, got %g", name, expected, got)
+				}
+			}
+			e := tt.expected
+			check("current ratio", e.CurrentRatio, got.CurrentRatio)
+			check("quick ratio", e.QuickRatio, got.QuickRatio)
+			check("debt to equity", e.DebtToEquity, got.DebtToEquity)
+			check("gross margin", e.GrossMargin, got.GrossMargin)
+			check("net margin", e.NetMargin, got.NetMargin)
+			check("return on equity", e.ReturnOnEquity, got.ReturnOnEquity)
+			check("return on assets", e.ReturnOnAssets, got.ReturnOnAssets)
+			check("price to earnings", e.PriceEarnings, got.PriceEarnings)
+			check("dividend yield", e.DividendYield, got.DividendYield)
+			check("payout ratio", e.PayoutRatio, got.PayoutRatio)
+		})
+	}
+}
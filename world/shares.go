@@ -0,0 +1,286 @@
+package world
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+
+	"github.com/google/uuid"
+	"github.com/nats-io/nats.go/micro"
+
+	"github.com/jxlxx/GreenIsland/bank"
+	"github.com/jxlxx/GreenIsland/broker"
+	"github.com/jxlxx/GreenIsland/payloads"
+	"github.com/jxlxx/GreenIsland/subjects"
+)
+
+// treasuryShares is how many of its own shares the company holds.
+func (c *Company) treasuryShares() int {
+	shares, err := c.broker.Get(c.id, c.Code, broker.Available)
+	if err != nil {
+		return 0
+	}
+	return shares
+}
+
+// buyback is a company's standing order to buy back its own shares at a
+// price in minor units. It stays open until the next quarter's order
+// replaces it.
+type buyback struct {
+	id     uuid.UUID
+	price  int
+	shares int
+	filled int
+}
+
+// repurchase replaces last quarter's buyback order with one for
+// ShareBuyback basis points of the outstanding shares at the ask, limited
+// to the cash above the liquidity floor, and reports the shares bought back
+// since the last report. The caller holds c.mu.
+func (c *Company) repurchase(activity *payloads.ShareActivity) {
+	c.placeBuyback()
+	if c.buyback != nil {
+		activity.BuybackOrder = c.buyback.shares
+	}
+	activity.Repurchased += c.repurchased
+	activity.RepurchaseCost += c.repurchaseCost
+	c.repurchased, c.repurchaseCost = 0, 0
+}
+
+// placeBuyback cancels the open buyback order and publishes a new one.
+// Shares only change hands when a holder fills the order: the households
+// fill their part of it straight away whenever the price is at or above
+// fair value, everybody else sells through the orders endpoint. The caller
+// holds c.mu.
+func (c *Company) placeBuyback() {
+	if old := c.buyback; old != nil {
+		c.buyback = nil
+		if old.filled < old.shares {
+			c.publishBuyback(old, "cancelled")
+		}
+	}
+	price := toMinor(c.Ask)
+	if c.broker == nil || price <= 0 {
+		return
+	}
+	spare := c.ledger.Balance(LiquidAssetsAccount) - toMinor(c.QuarterlyBehaviour.LiquidityFloor)
+	shares := buybackSize(c.OutstandingShares, c.QuarterlyBehaviour.ShareBuyback.Value, spare, price)
+	if shares <= 0 {
+		return
+	}
+	c.buyback = &buyback{id: uuid.New(), price: price, shares: shares}
+	c.publishBuyback(c.buyback, "open")
+
+	if c.households == nil || price < c.fromMicro(c.fairValue(), bank.Minor) {
+		return
+	}
+	holders, err := c.broker.Holders(c.Code)
+	if err != nil {
+		log.Println(c.Code, err)
+		return
+	}
+	delete(holders, c.id)
+	total := 0
+	for _, held := range holders {
+		total += held
+	}
+	for _, account := range c.households() {
+		n := proportion(shares, holders[account.AccountID], total)
+		if n <= 0 {
+			continue
+		}
+		if _, err := c.fillBuyback(account.AccountID, account, n); err != nil {
+			log.Println(c.Code, err)
+		}
+	}
+}
+
+// buybackSize is how many shares a buyback of bps basis points of the
+// outstanding shares can pay for out of spare cash at price.
+func buybackSize(outstanding, bps, spare, price int) int {
+	return max(0, min(outstanding*bps/10000, spare/price))
+}
+
+// SellShares fills a company's open buyback order with a holder's shares,
+// paying the seller into their settlement account with the broker.
+func (c *Company) SellShares(fill payloads.OrderFill) (payloads.OrderFillResponse, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.buyback == nil || c.buyback.id != fill.OrderID {
+		return payloads.OrderFillResponse{}, fmt.Errorf("err: %s has no open order %s", c.Code, fill.OrderID)
+	}
+	account, err := c.broker.Settlement(fill.Seller)
+	if err != nil {
+		return payloads.OrderFillResponse{}, err
+	}
+	price := c.buyback.price
+	n, err := c.fillBuyback(fill.Seller, account, fill.Shares)
+	if err != nil {
+		return payloads.OrderFillResponse{}, err
+	}
+	c.BalanceSheet.sync(c.ledger)
+	return payloads.OrderFillResponse{Status: "OK", Shares: n, Price: price}, nil
+}
+
+// fillBuyback buys up to shares of a holder's into the open buyback order,
+// paying them into account, and returns how many were bought. The shares
+// are taken out of the order before the holder is paid, so no other fill can
+// claim them meanwhile. The caller holds c.mu.
+func (c *Company) fillBuyback(holder uuid.UUID, account bank.AccountRef, shares int) (int, error) {
+	b := c.buyback
+	if b == nil || c.closed {
+		return 0, fmt.Errorf("err: %s has no open buyback order", c.Code)
+	}
+	n := min(shares, b.shares-b.filled)
+	if n <= 0 {
+		return 0, fmt.Errorf("err: %s buyback order is filled", c.Code)
+	}
+	b.filled += n
+	if err := c.buyShares(holder, account, n, b.price); err != nil {
+		b.filled -= n
+		return 0, err
+	}
+	c.repurchased += n
+	c.repurchaseCost += n * b.price
+	status := "open"
+	if b.filled == b.shares {
+		status = "filled"
+	}
+	c.publishBuyback(b, status)
+	return n, nil
+}
+
+// buyShares takes a holder's shares and pays them the price for them. The
+// shares are kept as treasury stock. The caller holds c.mu, which is let go
+// while the holder is paid.
+func (c *Company) buyShares(holder uuid.UUID, account bank.AccountRef, shares, price int) error {
+	if err := c.broker.Transfer(holder, c.id, c.Code, shares, false); err != nil {
+		return err
+	}
+	var err error
+	c.unlocked(func() { err = pay(c.nc, c.account, account, money(c.DefaultCurrency, shares*price)) })
+	if err != nil {
+		if err := c.broker.Transfer(c.id, holder, c.Code, shares, false); err != nil {
+			log.Println(c.Code, err)
+		}
+		return err
+	}
+	c.OutstandingShares -= shares
+	c.book(TreasuryStockAccount, LiquidAssetsAccount, shares*price, "share repurchase")
+	return nil
+}
+
+func (c *Company) publishBuyback(b *buyback, status string) {
+	if c.nc == nil {
+		return
+	}
+	order := payloads.ShareOrder{
+		ID:           b.id,
+		Company:      c.Code,
+		Side:         "buy",
+		Status:       status,
+		CurrencyCode: c.DefaultCurrency,
+		CurrencyUnit: bank.Minor,
+		Price:        b.price,
+		Shares:       b.shares,
+		Filled:       b.filled,
+	}
+	if err := c.nc.Publish(subjects.Order(c.Code, "buy"), order); err != nil {
+		log.Println(c.Code, err)
+	}
+}
+
+// raiseCapital runs a secondary offering at the bid when liquid assets are
+// below the liquidity floor. Treasury shares are sold first and new shares
+// issued for the rest. The offering is taken up by the households of the
+// home country. The caller holds c.mu, which is let go while they pay.
+func (c *Company) raiseCapital(activity *payloads.ShareActivity) {
+	price := toMinor(c.Bid)
+	if c.broker == nil || c.country == nil || price <= 0 {
+		return
+	}
+	needed := toMinor(c.QuarterlyBehaviour.LiquidityFloor) - c.ledger.Balance(LiquidAssetsAccount)
+	if needed <= 0 {
+		return
+	}
+	shares := (needed + price - 1) / price
+	buyer := c.country.households
+	var err error
+	c.unlocked(func() { err = pay(c.nc, buyer, c.account, money(c.DefaultCurrency, shares*price)) })
+	if err != nil {
+		log.Println(c.Code, err)
+		return
+	}
+	if err := c.broker.SetSettlement(buyer.AccountID, buyer); err != nil {
+		log.Println(c.Code, err)
+	}
+
+	held := c.treasuryShares()
+	reissued := min(shares, held)
+	if reissued > 0 {
+		cost := proportion(c.ledger.Balance(TreasuryStockAccount), reissued, held)
+		if err := c.broker.Transfer(c.id, buyer.AccountID, c.Code, reissued, false); err != nil {
+			log.Println(c.Code, err)
+			reissued = 0
+		} else {
+			c.book(LiquidAssetsAccount, TreasuryStockAccount, cost, "treasury shares reissued")
+			c.book(LiquidAssetsAccount, ShareCapitalAccount, reissued*price-cost, "treasury shares reissued")
+		}
+	}
+	issued := shares - reissued
+	if err := c.broker.Credit(buyer.AccountID, c.Code, issued); err != nil {
+		log.Println(c.Code, err)
+		c.unlocked(func() { err = pay(c.nc, c.account, buyer, money(c.DefaultCurrency, issued*price)) })
+		if err != nil {
+			log.Println(c.Code, err)
+		}
+		issued = 0
+		shares = reissued
+	}
+	c.book(LiquidAssetsAccount, ShareCapitalAccount, issued*price, "shares issued")
+	c.OutstandingShares += shares
+	activity.Issued += shares
+	activity.IssueProceeds += shares * price
+}
+
+// households lists the households' accounts of every country. They are the
+// holders the engine sells for.
+func (w *World) households() []bank.AccountRef {
+	accounts := []bank.AccountRef{}
+	for _, c := range w.countries {
+		accounts = append(accounts, c.households)
+	}
+	return accounts
+}
+
+// FillOrder sells a holder's shares into a company's open buyback order.
+// The request names the seller, so it is only served to admin clients.
+func (w *World) FillOrder(req micro.Request) {
+	fill := payloads.OrderFill{}
+	if err := json.Unmarshal(req.Data(), &fill); err != nil {
+		respondError(req, "cannot parse request")
+		return
+	}
+	if fill.Shares <= 0 {
+		respondError(req, "shares must be positive")
+		return
+	}
+	w.mu.Lock()
+	companies := w.companies
+	w.mu.Unlock()
+	for _, c := range companies {
+		if c.Code != fill.Company {
+			continue
+		}
+		res, err := c.SellShares(fill)
+		if err != nil {
+			respondError(req, err.Error())
+			return
+		}
+		if err := req.RespondJSON(res); err != nil {
+			log.Println(err)
+		}
+		return
+	}
+	respondError(req, fmt.Sprintf("no company %s", fill.Company))
+}
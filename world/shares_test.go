@@ -0,0 +1,57 @@
+package world
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+
+	"github.com/jxlxx/GreenIsland/bank"
+)
+
+func TestBuybackSize(t *testing.T) {
+	tests := []struct {
+		name        string
+		outstanding int
+		bps         int
+		spare       int
+		price       int
+		expected    int
+	}{
+		{"share of outstanding", 100000, 100, 1000000, 100, 1000},
+		{"limited by cash", 100000, 100, 50000, 100, 500},
+		{"no buyback", 100000, 0, 1000000, 100, 0},
+		{"below the floor", 100000, 100, -5000, 100, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := buybackSize(tt.outstanding, tt.bps, tt.spare, tt.price); got != tt.expected {
+				t.Errorf("expected %d, got %d", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestFillBuybackNeedsOpenOrder(t *testing.T) {
+	seller := bank.AccountRef{AccountID: uuid.New()}
+	tests := []struct {
+		name    string
+		buyback *buyback
+		closed  bool
+	}{
+		{"no order", nil, false},
+		{"filled", &buyback{price: 100, shares: 10, filled: 10}, false},
+		{"closed", &buyback{price: 100, shares: 10}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &Company{Code: "TEST", buyback: tt.buyback, closed: tt.closed}
+			n, err := c.fillBuyback(seller.AccountID, seller, 5)
+			if err == nil || n != 0 {
+				t.Errorf("expected no shares bought and an error, got %d, %v", n, err)
+			}
+			if c.repurchased != 0 {
+				t.Errorf("expected nothing repurchased, got %d", c.repurchased)
+			}
+		})
+	}
+}
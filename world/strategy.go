@@ -0,0 +1,159 @@
+package world
+
+import (
+	"log"
+)
+
+// Strategy decides what a company does. It is consulted every day and at the
+// end of every quarter with a snapshot of the company and its country.
+type Strategy interface {
+	Daily(s Situation) DailyDecision
+	Quarterly(s Situation) QuarterlyDecision
+}
+
+// Situation is what a strategy knows. Money is in minor units, EPS and
+// Dividend are per share in micro units and Revenue and EPS are at the
+// current quarterly run rate.
+type Situation struct {
+	Outlook        Outlook
+	Liquid         int
+	LiquidityFloor int
+	Equity         int
+	Liabilities    int
+	CapitalAssets  int
+	Revenue        int
+	EPS            int
+	Dividend       int
+	Employees      int
+}
+
+// DailyDecision hires (or, when negative, lays off) employees and spends on
+// capital assets beyond replacing depreciation.
+type DailyDecision struct {
+	Hiring          int
+	CapitalSpending int
+}
+
+// QuarterlyDecision sets next quarter's dividend per share in micro units,
+// the price the company asks relative to the market in basis points and how
+// much it wants to borrow in minor units.
+type QuarterlyDecision struct {
+	Dividend int
+	Pricing  int
+	Borrow   int
+}
+
+var strategies = map[string]Strategy{
+	"conservative": Conservative{},
+	"growth":       Growth{},
+	"distressed":   Distressed{},
+}
+
+func strategyFor(name string) Strategy {
+	if name == "" {
+		return Conservative{}
+	}
+	s, ok := strategies[name]
+	if !ok {
+		log.Println("err: unknown strategy:", name)
+		return Conservative{}
+	}
+	return s
+}
+
+// Conservative keeps its workforce, pays out 40% of earnings and only cuts
+// staff in a downturn.
+type Conservative struct{}
+
+func (Conservative) Daily(s Situation) DailyDecision {
+	switch s.Outlook.Phase {
+	case Recession, Trough:
+		return DailyDecision{Hiring: -s.Employees / 5000}
+	}
+	return DailyDecision{}
+}
+
+func (Conservative) Quarterly(s Situation) QuarterlyDecision {
+	return QuarterlyDecision{
+		Dividend: max(0, s.EPS*40/100),
+	}
+}
+
+// Growth hires and invests a hundredth of its spare cash every day outside a
+// recession, discounts its prices to win market share, pays out little and
+// borrows to stay above its liquidity floor.
+type Growth struct{}
+
+func (Growth) Daily(s Situation) DailyDecision {
+	switch s.Outlook.Phase {
+	case Recession, Trough:
+		return DailyDecision{}
+	}
+	return DailyDecision{
+		Hiring:          s.Employees / 2000,
+		CapitalSpending: max(0, s.Liquid-s.LiquidityFloor) / 100,
+	}
+}
+
+func (Growth) Quarterly(s Situation) QuarterlyDecision {
+	return QuarterlyDecision{
+		Dividend: max(0, s.EPS*10/100),
+		Pricing:  -200,
+		Borrow:   max(0, s.LiquidityFloor-s.Liquid),
+	}
+}
+
+// Distressed sheds staff, stops investing and paying dividends, sells at a
+// steep discount and borrows whatever it needs.
+type Distressed struct{}
+
+func (Distressed) Daily(s Situation) DailyDecision {
+	return DailyDecision{Hiring: -s.Employees / 1000}
+}
+
+func (Distressed) Quarterly(s Situation) QuarterlyDecision {
+	return QuarterlyDecision{
+		Pricing: -500,
+		Borrow:  max(0, s.LiquidityFloor-s.Liquid),
+	}
+}
+
+// situation snapshots the company for its strategy. The caller holds c.mu.
+func (c *Company) situation(outlook Outlook) Situation {
+	return Situation{
+		Outlook:        outlook,
+		Liquid:         c.ledger.Balance(LiquidAssetsAccount),
+		LiquidityFloor: toMinor(c.QuarterlyBehaviour.LiquidityFloor),
+		Equity:         c.ledger.Equity(),
+		Liabilities:    c.ledger.Liabilities(),
+		CapitalAssets:  c.ledger.Balance(CapitalAssetsAccount),
+		Revenue:        toMinor(c.Income.OperatingRevenue),
+		EPS:            int(c.runRateEPS()),
+		Dividend:       toMicro(c.QuarterlyBehaviour.DividendPayout),
+		Employees:      c.Employment.Employees.Value,
+	}
+}
+
+// decideDaily hires and invests. Capital spending is bought on account and
+// adds to capacity in proportion to the capital assets already in place.
+func (c *Company) decideDaily(d DailyDecision) {
+	employees := &c.Employment.Employees
+	employees.Value = max(0, employees.Value+d.Hiring)
+
+	capital := c.ledger.Balance(CapitalAssetsAccount)
+	if d.CapitalSpending <= 0 || capital <= 0 {
+		return
+	}
+	for industry, units := range c.Industries.Capacity {
+		c.Industries.Capacity[industry] = units + proportion(units, d.CapitalSpending, capital)
+	}
+	c.book(CapitalAssetsAccount, AccountsPayableAccount, d.CapitalSpending, "capital spending")
+}
+
+// decideQuarterly sets the next dividend, pricing and borrowing.
+func (c *Company) decideQuarterly(d QuarterlyDecision) {
+	payout := &c.QuarterlyBehaviour.DividendPayout
+	payout.Value = c.fromMicro(float64(d.Dividend), payout.Unit)
+	c.pricing = d.Pricing
+	c.borrow = d.Borrow
+}
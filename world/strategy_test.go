@@ -0,0 +1,97 @@
+package world
+
+import (
+	"testing"
+)
+
+func TestStrategyFor(t *testing.T) {
+	tests := []struct {
+		name     string
+		strategy string
+		expected Strategy
+	}{
+		{"default", "", Conservative{}},
+		{"growth", "growth", Growth{}},
+		{"distressed", "distressed", Distressed{}},
+		{"unknown", "reckless", Conservative{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := strategyFor(tt.strategy); got != tt.expected {
+				t.Errorf("expected %T, got %T", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestStrategyDecisions(t *testing.T) {
+	situation := func(phase CompanyCycle) Situation {
+		return Situation{
+			Outlook:        Outlook{Phase: phase},
+			Liquid:         50000,
+			LiquidityFloor: 80000,
+			EPS:            1000,
+			Employees:      10000,
+		}
+	}
+	spare := situation(Expansion)
+	spare.Liquid = 180000
+	tests := []struct {
+		name      string
+		strategy  Strategy
+		situation Situation
+		daily     DailyDecision
+		quarterly QuarterlyDecision
+	}{
+		{"conservative keeps staff", Conservative{}, situation(Expansion), DailyDecision{}, QuarterlyDecision{Dividend: 400}},
+		{"conservative cuts in a recession", Conservative{}, situation(Recession), DailyDecision{Hiring: -2}, QuarterlyDecision{Dividend: 400}},
+		{"growth hires", Growth{}, situation(Expansion), DailyDecision{Hiring: 5}, QuarterlyDecision{Dividend: 100, Pricing: -200, Borrow: 30000}},
+		{"growth invests spare cash", Growth{}, spare, DailyDecision{Hiring: 5, CapitalSpending: 1000}, QuarterlyDecision{Dividend: 100, Pricing: -200}},
+		{"growth waits out a trough", Growth{}, situation(Trough), DailyDecision{}, QuarterlyDecision{Dividend: 100, Pricing: -200, Borrow: 30000}},
+		{"distressed", Distressed{}, situation(Expansion), DailyDecision{Hiring: -10}, QuarterlyDecision{Pricing: -500, Borrow: 30000}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.strategy.Daily(tt.situation); got != tt.daily {
+				t.Errorf("expected %+v, got %+v", tt.daily, got)
+			}
+			if got := tt.strategy.Quarterly(tt.situation); got != tt.quarterly {
+				t.Errorf("expected %+v, got %+v", tt.quarterly, got)
+			}
+		})
+	}
+}
+
+func TestDecideDaily(t *testing.T) {
+	tests := []struct {
+		name      string
+		decision  DailyDecision
+		employees int
+		capacity  int
+		capital   int
+	}{
+		{"hires", DailyDecision{Hiring: 10}, 110, 1000, 10000},
+		{"never below nobody", DailyDecision{Hiring: -500}, 0, 1000, 10000},
+		{"capacity grows with capital", DailyDecision{CapitalSpending: 1000}, 100, 1100, 11000},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &Company{ledger: NewLedger("USD")}
+			c.Employment.Employees.Value = 100
+			c.Industries.Capacity = map[Industry]int{Mining: 1000}
+			if err := c.ledger.Post(CapitalAssetsAccount, ShareCapitalAccount, 10000, "test"); err != nil {
+				t.Fatal(err)
+			}
+			c.decideDaily(tt.decision)
+			if got := c.Employment.Employees.Value; got != tt.employees {
+				t.Errorf("expected %d employees, got %d", tt.employees, got)
+			}
+			if got := c.Industries.Capacity[Mining]; got != tt.capacity {
+				t.Errorf("expected capacity of %d, got %d", tt.capacity, got)
+			}
+			if got := c.ledger.Balance(CapitalAssetsAccount); got != tt.capital {
+				t.Errorf("expected capital assets of %d, got %d", tt.capital, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,261 @@
+package world
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/jxlxx/GreenIsland/bank"
+	"github.com/jxlxx/GreenIsland/payloads"
+)
+
+// Subsidiary is a company's business in another country. It earns and
+// spends its own Income in the local currency, through its own account at
+// BankCode, and keeps its own books in that currency. At the end of every
+// quarter its results are consolidated into the company's, and it sends
+// Repatriation basis points of its cash home. Its cash is carried in the
+// company's books at the rates it was earned at until it is translated at
+// the end of the quarter.
+type Subsidiary struct {
+	CountryCode  string            `yaml:"country_code"`
+	BankCode     string            `yaml:"bank_code"`
+	Currency     bank.CurrencyCode `yaml:"currency_code"`
+	Income       Income            `yaml:"income"`
+	Repatriation int               `yaml:"repatriation"`
+
+	account bank.AccountRef
+	country *Country
+	ledger  *Ledger
+	cash    int
+	carried int
+	// earned is the quarter's income lines translated at the rate of the
+	// day they were earned, in minor units of the company's currency.
+	earned map[LedgerAccount]int
+	// results are the last closed quarter's, in minor units of the local
+	// currency.
+	results map[LedgerAccount]int
+}
+
+// subsidiaryLines are the income lines a subsidiary trades on.
+var subsidiaryLines = []LedgerAccount{
+	OperatingRevenueAccount,
+	ProductionExpensesAccount,
+	AdministrativeExpensesAccount,
+}
+
+// openSubsidiaries opens a bank account and books for every subsidiary.
+func (c *Company) openSubsidiaries() error {
+	for _, s := range c.Subsidiaries {
+		account, err := openAccount(c.nc, s.CountryCode, s.BankCode, c.id)
+		if err != nil {
+			return err
+		}
+		s.account = account
+		s.ledger = NewLedger(s.Currency)
+		s.earned = map[LedgerAccount]int{}
+	}
+	return nil
+}
+
+// tradeAbroad posts a day of each subsidiary's trading in its own books and
+// moves the net cash between its account and the households of the country
+// it trades in. The day's income is translated at the hour's rate for
+// consolidation. The caller holds c.mu.
+func (c *Company) tradeAbroad(hour int) {
+	days := make([]map[LedgerAccount]int, len(c.Subsidiaries))
+	for i, s := range c.Subsidiaries {
+		s.Income = s.Income.Update()
+		days[i] = map[LedgerAccount]int{
+			OperatingRevenueAccount:       daily(s.Income.OperatingRevenue),
+			ProductionExpensesAccount:     daily(s.Income.ProductionExpenses),
+			AdministrativeExpensesAccount: daily(s.Income.AdministrativeExpenses),
+		}
+	}
+	errs := make([]error, len(c.Subsidiaries))
+	c.unlocked(func() {
+		for i, s := range c.Subsidiaries {
+			errs[i] = c.settleAbroad(s, netCash(days[i]))
+		}
+	})
+	for i, s := range c.Subsidiaries {
+		if errs[i] != nil {
+			log.Println(c.Code, s.CountryCode, errs[i])
+			continue
+		}
+		lines := days[i]
+		for _, a := range subsidiaryLines {
+			v, err := c.fx.Convert(money(s.Currency, lines[a]), c.DefaultCurrency, hour)
+			if err != nil {
+				log.Println(c.Code, err)
+				continue
+			}
+			s.earned[a] += toMinor(v)
+		}
+		s.post(OperatingRevenueAccount, lines[OperatingRevenueAccount], "sales")
+		s.post(ProductionExpensesAccount, -lines[ProductionExpensesAccount], "production")
+		s.post(AdministrativeExpensesAccount, -lines[AdministrativeExpensesAccount], "administration")
+		s.cash += netCash(lines)
+	}
+}
+
+// netCash is what a day of a subsidiary's trading brings in.
+func netCash(lines map[LedgerAccount]int) int {
+	return lines[OperatingRevenueAccount] - lines[ProductionExpensesAccount] - lines[AdministrativeExpensesAccount]
+}
+
+// settleAbroad moves a day's net cash between the households of a
+// subsidiary's country and the subsidiary.
+func (c *Company) settleAbroad(s *Subsidiary, cash int) error {
+	if s.country == nil {
+		return fmt.Errorf("err: no households to trade with in %s", s.CountryCode)
+	}
+	if cash >= 0 {
+		return pay(c.nc, s.country.households, s.account, money(s.Currency, cash))
+	}
+	return pay(c.nc, s.account, s.country.households, money(s.Currency, -cash))
+}
+
+// post books cash earned, or spent if negative, against an income line in
+// the subsidiary's own books.
+func (s *Subsidiary) post(line LedgerAccount, amount int, memo string) {
+	if err := s.ledger.Post(LiquidAssetsAccount, line, amount, memo); err != nil {
+		log.Println(s.CountryCode, err)
+	}
+}
+
+// consolidate brings the subsidiaries' quarter into the company's books at
+// the rates it was earned at, then revalues their cash at the hour's rate and
+// books the difference as a translation gain or loss. Their cash is carried
+// as foreign cash, apart from the liquid assets in the company's own account.
+// Their own books are closed. The caller holds c.mu.
+func (c *Company) consolidate(hour int) {
+	for _, s := range c.Subsidiaries {
+		for _, a := range subsidiaryLines {
+			v := s.earned[a]
+			if ledgerAccounts[a] == expenseAccount {
+				v = -v
+			}
+			c.book(ForeignCashAccount, a, v, "consolidated from "+s.CountryCode)
+			s.carried += v
+		}
+		s.earned = map[LedgerAccount]int{}
+		s.results = map[LedgerAccount]int{}
+		for _, a := range subsidiaryLines {
+			s.results[a] = s.ledger.Balance(a)
+		}
+		s.ledger.Close()
+
+		v, err := c.fx.Convert(money(s.Currency, s.cash), c.DefaultCurrency, hour)
+		if err != nil {
+			log.Println(c.Code, err)
+			continue
+		}
+		value := toMinor(v)
+		c.book(ForeignCashAccount, FXTranslationAccount, value-s.carried, "translation of "+s.CountryCode)
+		s.carried = value
+	}
+}
+
+// remittance is cash a subsidiary sends home, in its own currency and in
+// the company's.
+type remittance struct {
+	s           *Subsidiary
+	local, home int
+	err         error
+}
+
+// repatriate consolidates the subsidiaries and sends each one's
+// repatriation share of its cash home. The caller holds c.mu, which is let
+// go while the money moves.
+func (c *Company) repatriate(hour int) {
+	c.consolidate(hour)
+	rs := c.remittances(func(s *Subsidiary) int { return s.Repatriation })
+	c.unlocked(func() { c.remit(rs) })
+	c.bookRemittances(rs)
+}
+
+// repatriateAll brings every subsidiary's cash home before the company
+// closes. The caller holds c.mu.
+func (c *Company) repatriateAll() {
+	if c.fx == nil {
+		return
+	}
+	c.consolidate(c.hour)
+	rs := c.remittances(func(*Subsidiary) int { return 10000 })
+	c.remit(rs)
+	c.bookRemittances(rs)
+}
+
+// remittances works out how much of each subsidiary's cash to send home,
+// given a share of it in basis points. The caller holds c.mu.
+func (c *Company) remittances(share func(*Subsidiary) int) []*remittance {
+	rs := []*remittance{}
+	for _, s := range c.Subsidiaries {
+		local := proportion(s.cash, min(share(s), 10000), 10000)
+		if local <= 0 {
+			continue
+		}
+		rs = append(rs, &remittance{s: s, local: local, home: proportion(s.carried, local, s.cash)})
+	}
+	return rs
+}
+
+func (c *Company) remit(rs []*remittance) {
+	for _, r := range rs {
+		r.err = transfer(c.nc, r.s.account, c.account, money(r.s.Currency, r.local), money(c.DefaultCurrency, r.home))
+	}
+}
+
+// bookRemittances books the cash that made it home. The caller holds c.mu.
+func (c *Company) bookRemittances(rs []*remittance) {
+	for _, r := range rs {
+		if r.err != nil {
+			log.Println(c.Code, r.err)
+			continue
+		}
+		c.book(LiquidAssetsAccount, ForeignCashAccount, r.home, "sent home from "+r.s.CountryCode)
+		r.s.post(RetainedEarningsAccount, -r.local, "sent home")
+		r.s.cash -= r.local
+		r.s.carried -= r.home
+	}
+}
+
+// subsidiaryRunRate is the subsidiaries' quarterly revenue and earnings at
+// their current run rate, translated at the latest rate, in minor units.
+func (c *Company) subsidiaryRunRate() (int, int) {
+	revenue, earnings := 0, 0
+	for _, s := range c.Subsidiaries {
+		i := s.Income
+		r := c.atLatestRate(i.OperatingRevenue)
+		revenue += r
+		earnings += r - c.atLatestRate(i.ProductionExpenses) - c.atLatestRate(i.AdministrativeExpenses)
+	}
+	return revenue, earnings
+}
+
+func (c *Company) atLatestRate(v bank.CurrencyValue) int {
+	if c.fx == nil {
+		return 0
+	}
+	converted, err := c.fx.Convert(v, c.DefaultCurrency, c.hour)
+	if err != nil {
+		log.Println(c.Code, err)
+		return 0
+	}
+	return toMinor(converted)
+}
+
+func (c *Company) CreateSubsidiaries() []payloads.Subsidiary {
+	subsidiaries := []payloads.Subsidiary{}
+	for _, s := range c.Subsidiaries {
+		subsidiaries = append(subsidiaries, payloads.Subsidiary{
+			CountryCode:  s.CountryCode,
+			CurrencyCode: s.Currency,
+			CurrencyUnit: bank.Minor,
+			Revenue:      s.results[OperatingRevenueAccount],
+			Expenses:     s.results[ProductionExpensesAccount] + s.results[AdministrativeExpensesAccount],
+			Cash:         s.cash,
+			Carried:      s.carried,
+		})
+	}
+	return subsidiaries
+}
@@ -0,0 +1,91 @@
+package world
+
+import (
+	"testing"
+
+	"github.com/jxlxx/GreenIsland/bank"
+)
+
+func TestConsolidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		rate    float64
+		carried int
+	}{
+		{"rate unchanged", 0.8, 400},
+		{"local currency falls", 0.5, 250},
+		{"local currency rises", 1, 500},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fx := &FXMarket{
+				history: map[int]map[bank.CurrencyCode]float64{
+					0:  {"USD": 1, "CAD": 0.8},
+					10: {"USD": 1, "CAD": tt.rate},
+				},
+				hours: []int{0, 10},
+			}
+			s := &Subsidiary{
+				CountryCode: "CA",
+				Currency:    "CAD",
+				ledger:      NewLedger("CAD"),
+				cash:        500,
+				earned: map[LedgerAccount]int{
+					OperatingRevenueAccount:       800,
+					ProductionExpensesAccount:     300,
+					AdministrativeExpensesAccount: 100,
+				},
+			}
+			s.post(OperatingRevenueAccount, 1000, "sales")
+			s.post(ProductionExpensesAccount, -375, "production")
+			s.post(AdministrativeExpensesAccount, -125, "administration")
+			c := &Company{DefaultCurrency: "USD", fx: fx, ledger: NewLedger("USD"), Subsidiaries: []*Subsidiary{s}}
+
+			c.consolidate(10)
+			if s.carried != tt.carried {
+				t.Errorf("expected %d carried, got %d", tt.carried, s.carried)
+			}
+			if got := c.ledger.Balance(ForeignCashAccount); got != tt.carried {
+				t.Errorf("expected %d foreign cash, got %d", tt.carried, got)
+			}
+			if got := c.ledger.Balance(LiquidAssetsAccount); got != 0 {
+				t.Errorf("expected no liquid assets, got %d", got)
+			}
+			if got := c.ledger.Balance(OperatingRevenueAccount); got != 800 {
+				t.Errorf("expected revenue of 800, got %d", got)
+			}
+			if s.results[OperatingRevenueAccount] != 1000 || len(s.earned) != 0 {
+				t.Errorf("expected the quarter closed, got results %v and earned %v", s.results, s.earned)
+			}
+		})
+	}
+}
+
+func TestSubsidiaryRunRate(t *testing.T) {
+	fx := &FXMarket{
+		history: map[int]map[bank.CurrencyCode]float64{0: {"USD": 1, "CAD": 0.5}},
+		hours:   []int{0},
+	}
+	s := &Subsidiary{Currency: "CAD"}
+	s.Income.OperatingRevenue = money("CAD", 10000)
+	s.Income.ProductionExpenses = money("CAD", 4000)
+	s.Income.AdministrativeExpenses = money("CAD", 2000)
+	tests := []struct {
+		name     string
+		fx       *FXMarket
+		revenue  int
+		earnings int
+	}{
+		{"translated", fx, 5000, 2000},
+		{"no rates", nil, 0, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &Company{DefaultCurrency: "USD", fx: tt.fx, Subsidiaries: []*Subsidiary{s}}
+			revenue, earnings := c.subsidiaryRunRate()
+			if revenue != tt.revenue || earnings != tt.earnings {
+				t.Errorf("expected %d and %d, got %d and %d", tt.revenue, tt.earnings, revenue, earnings)
+			}
+		})
+	}
+}
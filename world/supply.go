@@ -0,0 +1,284 @@
+package world
+
+import (
+	"log"
+
+	"github.com/jxlxx/GreenIsland/bank"
+	"github.com/jxlxx/GreenIsland/payloads"
+)
+
+// Supply is what a market's producers buy from other industries. Inputs is
+// how much of a unit of each industry, in basis points, goes into a unit of
+// output. Suppliers invoice for what they deliver and are paid PaymentDays
+// later.
+type Supply struct {
+	Inputs      map[Industry]int `yaml:"inputs"`
+	PaymentDays int              `yaml:"payment_days"`
+}
+
+// supplyContract is a quarter's order of units from a supplier, delivered
+// evenly over the quarter.
+type supplyContract struct {
+	buyer    *Company
+	seller   *Company
+	industry Industry
+	units    int
+	terms    int
+}
+
+// invoice is owed by the buyer for a delivery. Each side holds it in its own
+// currency, converted on the day of delivery. Paid is what the seller got of
+// it from a liquidated buyer.
+type invoice struct {
+	buyer  *Company
+	seller *Company
+	owed   bank.CurrencyValue
+	billed bank.CurrencyValue
+	due    int
+	paid   int
+}
+
+// contractSupplies orders the inputs for what each producer sold this
+// quarter from the spare capacity of the producers of each input, in
+// proportion to it. Nobody supplies itself. The caller holds w.mu.
+func (w *World) contractSupplies(sold, spare map[Industry]map[*Company]int, hour int) []*supplyContract {
+	prices := map[Industry]bank.CurrencyValue{}
+	for _, m := range w.markets {
+		prices[m.Industry] = m.Price
+	}
+	for _, c := range w.companies {
+		c.resetSupplies()
+	}
+	contracts := []*supplyContract{}
+	for _, m := range w.markets {
+		for input, share := range m.Supply.Inputs {
+			free := spare[input]
+			total := 0
+			for _, units := range free {
+				total += units
+			}
+			for buyer, units := range sold[m.Industry] {
+				need := proportion(units, share, 10000)
+				for seller, available := range free {
+					if seller == buyer || available <= 0 {
+						continue
+					}
+					delivered := min(available, proportion(need, available, total))
+					if delivered <= 0 {
+						continue
+					}
+					free[seller] -= delivered
+					price := prices[input]
+					price.Value *= delivered
+					if err := w.priceContract(buyer, seller, price, hour); err != nil {
+						log.Println(err)
+						continue
+					}
+					contracts = append(contracts, &supplyContract{
+						buyer:    buyer,
+						seller:   seller,
+						industry: input,
+						units:    delivered,
+						terms:    m.Supply.PaymentDays,
+					})
+				}
+			}
+		}
+	}
+	return contracts
+}
+
+// priceContract adds a contract to the buyer's and seller's run rates.
+func (w *World) priceContract(buyer, seller *Company, price bank.CurrencyValue, hour int) error {
+	cost, err := w.fx.Convert(price, buyer.DefaultCurrency, hour)
+	if err != nil {
+		return err
+	}
+	revenue, err := w.fx.Convert(price, seller.DefaultCurrency, hour)
+	if err != nil {
+		return err
+	}
+	buyer.addSupplies(toMinor(cost), 0)
+	seller.addSupplies(0, toMinor(revenue))
+	return nil
+}
+
+// SupplySubscriber settles the invoices that are due and delivers a day of
+// every supply contract.
+func (w *World) SupplySubscriber() func(payloads.WorldTick) {
+	return func(p payloads.WorldTick) {
+		w.mu.Lock()
+		contracts, invoices := w.contracts, w.invoices
+		prices := map[Industry]bank.CurrencyValue{}
+		for _, m := range w.markets {
+			prices[m.Industry] = m.Price
+		}
+		w.mu.Unlock()
+		day := p.Days()
+		open := []*invoice{}
+		for _, inv := range invoices {
+			if !w.settleInvoice(inv, day) {
+				open = append(open, inv)
+			}
+		}
+		for _, s := range contracts {
+			price := prices[s.industry]
+			price.Value = price.Value * s.units / daysPerQuarter
+			if inv := w.deliver(s, price, day, p.EGT); inv != nil {
+				open = append(open, inv)
+			}
+		}
+		w.mu.Lock()
+		w.invoices = open
+		w.mu.Unlock()
+	}
+}
+
+// deliver invoices the buyer for a day of the contract.
+func (w *World) deliver(s *supplyContract, price bank.CurrencyValue, day, hour int) *invoice {
+	if price.Value <= 0 || s.buyer.isClosed() || s.seller.isClosed() {
+		return nil
+	}
+	owed, err := w.fx.Convert(price, s.buyer.DefaultCurrency, hour)
+	if err != nil {
+		log.Println(err)
+		return nil
+	}
+	billed, err := w.fx.Convert(price, s.seller.DefaultCurrency, hour)
+	if err != nil {
+		log.Println(err)
+		return nil
+	}
+	inv := &invoice{
+		buyer:  s.buyer,
+		seller: s.seller,
+		owed:   money(s.buyer.DefaultCurrency, toMinor(owed)),
+		billed: money(s.seller.DefaultCurrency, toMinor(billed)),
+		due:    day + s.terms,
+	}
+	s.buyer.purchase(inv)
+	s.seller.bill(inv)
+	return inv
+}
+
+// settleInvoice pays an invoice that is due from the buyer's bank account
+// into the seller's. It reports whether the invoice is done with. What a
+// closed buyer did not pay in its liquidation is written off by the seller
+// straight away, and a buyer owes nothing to a closed seller. An invoice the
+// buyer cannot pay stays open.
+func (w *World) settleInvoice(inv *invoice, day int) bool {
+	switch {
+	case inv.buyer.isClosed():
+		inv.seller.writeOffInvoice(inv)
+		return true
+	case inv.seller.isClosed():
+		inv.buyer.forgiveInvoice(inv)
+		return true
+	case day < inv.due:
+		return false
+	}
+	if err := transfer(w.nc, inv.buyer.account, inv.seller.account, inv.owed, inv.billed); err != nil {
+		log.Println(inv.buyer.Code, err)
+		return false
+	}
+	inv.buyer.payInvoice(inv)
+	inv.seller.collectInvoice(inv)
+	return true
+}
+
+func (c *Company) isClosed() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.closed
+}
+
+// ownProduction is the quarter's production expenses that are not bought in
+// from suppliers, in minor units. The caller holds c.mu.
+func (c *Company) ownProduction() int {
+	return max(0, toMinor(c.Income.ProductionExpenses)-c.purchases)
+}
+
+// resetSupplies starts a new quarter of supply contracts.
+func (c *Company) resetSupplies() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.purchases, c.supplies = 0, 0
+}
+
+// addSupplies adds to the quarter's run rate of inputs bought and supplies
+// sold.
+func (c *Company) addSupplies(purchases, supplies int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.purchases += purchases
+	c.supplies += supplies
+}
+
+func (c *Company) purchase(inv *invoice) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.book(ProductionExpensesAccount, AccountsPayableAccount, inv.owed.Value, "supplies from "+inv.seller.Code)
+	c.invoicesPayable += inv.owed.Value
+	c.payables = append(c.payables, inv)
+}
+
+func (c *Company) bill(inv *invoice) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.book(AccountsReceivablesAccount, OperatingRevenueAccount, inv.billed.Value, "supplies to "+inv.buyer.Code)
+	c.invoicesReceivable += inv.billed.Value
+}
+
+func (c *Company) payInvoice(inv *invoice) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.book(AccountsPayableAccount, LiquidAssetsAccount, inv.owed.Value, "invoice paid to "+inv.seller.Code)
+	c.invoicesPayable -= inv.owed.Value
+	c.dropPayable(inv)
+	c.BalanceSheet.sync(c.ledger)
+}
+
+func (c *Company) collectInvoice(inv *invoice) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.book(LiquidAssetsAccount, AccountsReceivablesAccount, inv.billed.Value, "invoice paid by "+inv.buyer.Code)
+	c.invoicesReceivable -= inv.billed.Value
+	c.BalanceSheet.sync(c.ledger)
+}
+
+func (c *Company) writeOffInvoice(inv *invoice) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.book(LiquidAssetsAccount, AccountsReceivablesAccount, inv.paid, "invoice paid in liquidation of "+inv.buyer.Code)
+	c.book(WriteOffsAccount, AccountsReceivablesAccount, inv.billed.Value-inv.paid, "invoice to "+inv.buyer.Code+" written off")
+	c.invoicesReceivable -= inv.billed.Value
+	c.BalanceSheet.sync(c.ledger)
+}
+
+func (c *Company) forgiveInvoice(inv *invoice) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.book(AccountsPayableAccount, DebtForgivenAccount, inv.owed.Value, "invoice from "+inv.seller.Code+" written off")
+	c.invoicesPayable -= inv.owed.Value
+	c.dropPayable(inv)
+	c.BalanceSheet.sync(c.ledger)
+}
+
+// dropPayable forgets an invoice the company no longer owes. The caller
+// holds c.mu.
+func (c *Company) dropPayable(inv *invoice) {
+	open := []*invoice{}
+	for _, p := range c.payables {
+		if p != inv {
+			open = append(open, p)
+		}
+	}
+	c.payables = open
+}
+
+// takeOverPayable makes an acquired target's invoice the company's own.
+func (c *Company) takeOverPayable(inv *invoice) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.payables = append(c.payables, inv)
+}
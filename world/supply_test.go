@@ -0,0 +1,119 @@
+package world
+
+import (
+	"testing"
+)
+
+func TestContractSupplies(t *testing.T) {
+	buyer := &Company{Code: "BUY", DefaultCurrency: "USD"}
+	small := &Company{Code: "SML", DefaultCurrency: "USD"}
+	large := &Company{Code: "LRG", DefaultCurrency: "USD"}
+	tests := []struct {
+		name      string
+		spare     map[*Company]int
+		delivered map[*Company]int
+	}{
+		{
+			name:      "split by spare capacity",
+			spare:     map[*Company]int{small: 30, large: 90},
+			delivered: map[*Company]int{small: 12, large: 37},
+		},
+		{
+			name:      "limited by spare capacity",
+			spare:     map[*Company]int{small: 10},
+			delivered: map[*Company]int{small: 10},
+		},
+		{
+			name:      "nobody supplies itself",
+			spare:     map[*Company]int{buyer: 100, large: 100},
+			delivered: map[*Company]int{large: 25},
+		},
+		{
+			name:      "no spare capacity",
+			spare:     map[*Company]int{},
+			delivered: map[*Company]int{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := &World{
+				fx: &FXMarket{},
+				markets: []*Market{
+					{Industry: Food, Supply: Supply{Inputs: map[Industry]int{Mining: 5000}, PaymentDays: 30}},
+					{Industry: Mining, Price: money("USD", 10)},
+				},
+				companies: []*Company{buyer, small, large},
+			}
+			sold := map[Industry]map[*Company]int{Food: {buyer: 100}}
+			spare := map[Industry]map[*Company]int{Mining: tt.spare}
+			contracts := w.contractSupplies(sold, spare, 0)
+			got := map[*Company]int{}
+			for _, c := range contracts {
+				if c.buyer != buyer || c.industry != Mining || c.terms != 30 {
+					t.Errorf("got contract %+v", c)
+				}
+				got[c.seller] += c.units
+			}
+			if len(got) != len(tt.delivered) {
+				t.Fatalf("expected %d suppliers, got %d", len(tt.delivered), len(got))
+			}
+			bought := 0
+			for seller, units := range tt.delivered {
+				if got[seller] != units {
+					t.Errorf("%s: expected %d units, got %d", seller.Code, units, got[seller])
+				}
+				if seller.supplies != units*10 {
+					t.Errorf("%s: expected supplies of %d, got %d", seller.Code, units*10, seller.supplies)
+				}
+				bought += units * 10
+			}
+			if buyer.purchases != bought {
+				t.Errorf("expected purchases of %d, got %d", bought, buyer.purchases)
+			}
+		})
+	}
+}
+
+func TestSettleInvoiceWithoutPayment(t *testing.T) {
+	tests := []struct {
+		name         string
+		buyerClosed  bool
+		sellerClosed bool
+		day          int
+		settled      bool
+		payable      int
+		receivable   int
+	}{
+		{"not due", false, false, 5, false, 1000, 1000},
+		{"buyer liquidated", true, false, 5, true, 1000, 0},
+		{"seller liquidated", false, true, 5, true, 0, 1000},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buyer := &Company{Code: "BUY", DefaultCurrency: "USD", ledger: NewLedger("USD"), closed: tt.buyerClosed}
+			seller := &Company{Code: "SEL", DefaultCurrency: "USD", ledger: NewLedger("USD"), closed: tt.sellerClosed}
+			inv := &invoice{
+				buyer:  buyer,
+				seller: seller,
+				owed:   money("USD", 1000),
+				billed: money("USD", 1000),
+				due:    10,
+			}
+			buyer.purchase(inv)
+			seller.bill(inv)
+			w := &World{}
+			if got := w.settleInvoice(inv, tt.day); got != tt.settled {
+				t.Errorf("expected settled to be %v, got %v", tt.settled, got)
+			}
+			if buyer.invoicesPayable != tt.payable {
+				t.Errorf("expected %d payable, got %d", tt.payable, buyer.invoicesPayable)
+			}
+			if seller.invoicesReceivable != tt.receivable {
+				t.Errorf("expected %d receivable, got %d", tt.receivable, seller.invoicesReceivable)
+			}
+			if tt.payable == 0 && len(buyer.payables) != 0 {
+				t.Errorf("expected the invoice to be dropped, got %d payables", len(buyer.payables))
+			}
+		})
+	}
+}
@@ -0,0 +1,231 @@
+package world
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/jxlxx/GreenIsland/bank"
+	"github.com/jxlxx/GreenIsland/payloads"
+	"github.com/jxlxx/GreenIsland/subjects"
+)
+
+// Trade describes how a country takes part in international trade.
+// Industries weights the country's output by industry, ExportShare is the
+// percentage of that output sold abroad and Tariffs are the basis points
+// charged on imports from each partner country.
+type Trade struct {
+	ExportShare int              `yaml:"export_share"`
+	Industries  map[Industry]int `yaml:"industries"`
+	Tariffs     map[string]int   `yaml:"tariffs"`
+}
+
+// tradeProfile is a consistent snapshot of the figures trade is driven by.
+type tradeProfile struct {
+	country    *Country
+	output     int
+	population int
+	trade      Trade
+}
+
+func (c *Country) tradeProfile() tradeProfile {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return tradeProfile{
+		country:    c,
+		output:     toMinor(c.GDP) / 4,
+		population: c.Population.Total(),
+		trade:      c.Trade,
+	}
+}
+
+func (t tradeProfile) industryOutput(industry Industry) int {
+	total := 0
+	for _, w := range t.trade.Industries {
+		total += w
+	}
+	if total == 0 {
+		return 0
+	}
+	return t.output * t.trade.Industries[industry] / total
+}
+
+// importWeight is how much of an industry's exports a country absorbs: big
+// countries with little domestic production of their own import the most.
+func (t tradeProfile) importWeight(industry Industry) int {
+	total := 0
+	for _, w := range t.trade.Industries {
+		total += w
+	}
+	if total == 0 {
+		return 0
+	}
+	return t.population / 1000 * (total - t.trade.Industries[industry]) / total
+}
+
+func (w *World) TradeSubscriber() func(payloads.WorldTick) {
+	return func(p payloads.WorldTick) {
+		flows := w.tradeFlows()
+		w.settleExports(flows, p.EGT)
+		w.collectTariffs(flows, p.EGT)
+
+		for _, c := range w.countries {
+			update := payloads.QuarterlyTradeUpdate{
+				Country:  c.Code,
+				Quarter:  p.Quarter,
+				Currency: c.Currency,
+				Balance:  map[bank.CurrencyCode]int{},
+			}
+			for _, f := range flows {
+				v := bank.CurrencyValue{Currency: f.Currency, Unit: f.CurrencyUnit, Value: f.Value}
+				home, err := w.fx.Convert(v, c.Currency, p.EGT)
+				if err != nil {
+					log.Println(err)
+				}
+				if f.Exporter == c.Code {
+					update.Exports = append(update.Exports, f)
+					update.Balance[f.Currency] += f.Value
+					update.NetBalance += home.Value
+				}
+				if f.Importer == c.Code {
+					update.Imports = append(update.Imports, f)
+					update.Balance[f.Currency] -= f.Value
+					update.NetBalance -= home.Value
+				}
+			}
+			if output := c.tradeProfile().output; output > 0 {
+				w.fx.SetTradeBalance(c.Currency, float64(update.NetBalance)/float64(output))
+			}
+			if err := w.nc.Publish(subjects.QuarterlyTradeUpdate(c.Code, p.Quarter), update); err != nil {
+				fmt.Println(err)
+			}
+		}
+	}
+}
+
+// tradeFlows splits each country's exportable output of every industry
+// between the other countries, net of the importer's tariff. Values are in
+// minor units of the exporter's currency, which is what trade settles in.
+func (w *World) tradeFlows() []payloads.TradeFlow {
+	profiles := []tradeProfile{}
+	for _, c := range w.countries {
+		profiles = append(profiles, c.tradeProfile())
+	}
+
+	flows := []payloads.TradeFlow{}
+	for _, exporter := range profiles {
+		for industry := range exporter.trade.Industries {
+			exportable := exporter.industryOutput(industry) * exporter.trade.ExportShare / 100
+			if exportable <= 0 {
+				continue
+			}
+			total := 0
+			for _, importer := range profiles {
+				if importer.country != exporter.country {
+					total += importer.importWeight(industry)
+				}
+			}
+			if total == 0 {
+				continue
+			}
+			for _, importer := range profiles {
+				if importer.country == exporter.country {
+					continue
+				}
+				gross := proportion(exportable, importer.importWeight(industry), total)
+				tariff := gross * importer.trade.Tariffs[exporter.country.Code] / 10000
+				flows = append(flows, payloads.TradeFlow{
+					Exporter:     exporter.country.Code,
+					Importer:     importer.country.Code,
+					Industry:     string(industry),
+					Currency:     exporter.country.Currency,
+					CurrencyUnit: bank.Minor,
+					Value:        gross - tariff,
+					Tariff:       tariff,
+				})
+			}
+		}
+	}
+	return flows
+}
+
+// settleExports has the households of each importing country pay exporting
+// companies their part of each flow, in proportion to how much of their
+// country's industry output they produce. Importers pay in their own
+// currency at the hour's rate.
+func (w *World) settleExports(flows []payloads.TradeFlow, hour int) {
+	importers := map[string]*Country{}
+	for _, c := range w.countries {
+		importers[c.Code] = c
+	}
+	for _, c := range w.countries {
+		profile := c.tradeProfile()
+		exports := map[*Company]map[*Country]int{}
+		for _, f := range flows {
+			if f.Exporter != c.Code || importers[f.Importer] == nil {
+				continue
+			}
+			industry := Industry(f.Industry)
+			output := profile.industryOutput(industry)
+			if output == 0 {
+				continue
+			}
+			for _, company := range c.headquartered() {
+				if revenue := company.industryRevenue(industry); revenue > 0 {
+					if exports[company] == nil {
+						exports[company] = map[*Country]int{}
+					}
+					exports[company][importers[f.Importer]] += min(f.Value, proportion(f.Value, revenue, output))
+				}
+			}
+		}
+
+		for _, company := range c.headquartered() {
+			sum := 0
+			for importer, v := range exports[company] {
+				if err := w.payExporter(importer, company, money(c.Currency, v), hour); err != nil {
+					log.Println(importer.Code, err)
+					continue
+				}
+				sum += v
+			}
+			company.export(money(c.Currency, sum))
+		}
+	}
+}
+
+// collectTariffs has the households of each importing country pay the
+// tariffs on their imports to their treasury, in their own currency at the
+// hour's rate.
+func (w *World) collectTariffs(flows []payloads.TradeFlow, hour int) {
+	importers := map[string]*Country{}
+	for _, c := range w.countries {
+		importers[c.Code] = c
+	}
+	for _, f := range flows {
+		importer := importers[f.Importer]
+		if importer == nil || f.Tariff <= 0 {
+			continue
+		}
+		v, err := w.fx.Convert(money(f.Currency, f.Tariff), importer.Currency, hour)
+		if err != nil {
+			log.Println(importer.Code, err)
+			continue
+		}
+		if err := importer.collectTariff(money(importer.Currency, toMinor(v))); err != nil {
+			log.Println(importer.Code, err)
+		}
+	}
+}
+
+// payExporter has an importing country's households pay a company for its
+// exports.
+func (w *World) payExporter(importer *Country, company *Company, v bank.CurrencyValue, hour int) error {
+	if v.Value <= 0 {
+		return nil
+	}
+	price, err := w.fx.Convert(v, importer.Currency, hour)
+	if err != nil {
+		return err
+	}
+	return transfer(w.nc, importer.households, company.account, price, v)
+}
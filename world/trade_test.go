@@ -0,0 +1,94 @@
+package world
+
+import (
+	"testing"
+
+	"github.com/jxlxx/GreenIsland/bank"
+)
+
+func TestTradeFlows(t *testing.T) {
+	country := func(code string, population int, industries map[Industry]int, tariffs map[string]int) *Country {
+		return &Country{
+			Code:       code,
+			Currency:   bank.CurrencyCode(code),
+			GDP:        money("USD", 4000000),
+			Population: Population{Cohorts: []Cohort{{Population: population}}},
+			Trade: Trade{
+				ExportShare: 10,
+				Industries:  industries,
+				Tariffs:     tariffs,
+			},
+		}
+	}
+	tests := []struct {
+		name      string
+		countries []*Country
+		// expected maps exporter, importer and industry to value and tariff.
+		expected map[[3]string][2]int
+	}{
+		{
+			name: "one importer",
+			countries: []*Country{
+				country("AAA", 1000000, map[Industry]int{Mining: 1}, nil),
+				country("BBB", 1000000, map[Industry]int{Food: 1}, nil),
+			},
+			expected: map[[3]string][2]int{
+				{"AAA", "BBB", "mining"}: {100000, 0},
+				{"BBB", "AAA", "food"}:   {100000, 0},
+			},
+		},
+		{
+			name: "tariff taken off the flow",
+			countries: []*Country{
+				country("AAA", 1000000, map[Industry]int{Mining: 1}, nil),
+				country("BBB", 1000000, map[Industry]int{Food: 1}, map[string]int{"AAA": 2500}),
+			},
+			expected: map[[3]string][2]int{
+				{"AAA", "BBB", "mining"}: {75000, 25000},
+				{"BBB", "AAA", "food"}:   {100000, 0},
+			},
+		},
+		{
+			name: "split by population",
+			countries: []*Country{
+				country("AAA", 1000000, map[Industry]int{Mining: 1}, nil),
+				country("BBB", 3000000, map[Industry]int{Food: 1}, nil),
+				country("CCC", 1000000, map[Industry]int{Food: 1}, nil),
+			},
+			expected: map[[3]string][2]int{
+				{"AAA", "BBB", "mining"}: {75000, 0},
+				{"AAA", "CCC", "mining"}: {25000, 0},
+				{"BBB", "AAA", "food"}:   {100000, 0},
+				{"BBB", "CCC", "food"}:   {0, 0},
+				{"CCC", "AAA", "food"}:   {100000, 0},
+				{"CCC", "BBB", "food"}:   {0, 0},
+			},
+		},
+		{
+			name: "nobody imports what they all make",
+			countries: []*Country{
+				country("AAA", 1000000, map[Industry]int{Food: 1}, nil),
+				country("BBB", 1000000, map[Industry]int{Food: 1}, nil),
+			},
+			expected: map[[3]string][2]int{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := &World{countries: tt.countries}
+			flows := w.tradeFlows()
+			got := map[[3]string][2]int{}
+			for _, f := range flows {
+				got[[3]string{f.Exporter, f.Importer, f.Industry}] = [2]int{f.Value, f.Tariff}
+			}
+			if len(got) != len(tt.expected) {
+				t.Fatalf("expected %v, got %v", tt.expected, got)
+			}
+			for key, v := range tt.expected {
+				if got[key] != v {
+					t.Errorf("%v: expected %v, got %v", key, v, got[key])
+				}
+			}
+		})
+	}
+}
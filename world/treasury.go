@@ -0,0 +1,344 @@
+package world
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"sync"
+
+	"github.com/google/uuid"
+	"github.com/nats-io/nats.go/micro"
+
+	"github.com/jxlxx/GreenIsland/bank"
+	"github.com/jxlxx/GreenIsland/payloads"
+)
+
+// Treasury runs a country's budget. Revenue and spending are quarterly
+// amounts; any shortfall is financed by issuing sovereign bonds.
+type Treasury struct {
+	BankCode    string                          `yaml:"bank_code"`
+	Cash        bank.CurrencyValue              `yaml:"cash"`
+	TaxRevenue  bank.CurrencyValue              `yaml:"tax_revenue"`
+	PublicWages bank.CurrencyValue              `yaml:"public_wages"`
+	Subsidies   map[Industry]bank.CurrencyValue `yaml:"subsidies"`
+	Bonds       BondTerms                       `yaml:"bonds"`
+
+	mu            sync.Mutex
+	account       bank.AccountRef
+	balance       int
+	debt          []*Bond
+	subscriptions []payloads.BondSubscription
+	series        int
+	tariffs       int
+}
+
+type BondTerms struct {
+	FaceValue        bank.CurrencyValue `yaml:"face_value"`
+	CouponRate       int                `yaml:"coupon_rate"`
+	MaturityQuarters int                `yaml:"maturity_quarters"`
+}
+
+// Bond is a holding of one series of sovereign debt. Face is in minor units
+// and CouponRate is in basis points per year.
+type Bond struct {
+	Series     string
+	Holder     bank.AccountRef
+	Currency   bank.CurrencyCode
+	Face       int
+	CouponRate int
+	Maturity   int
+}
+
+func (b Bond) Coupon() int {
+	return b.Face * b.CouponRate / 10000 / 4
+}
+
+// OpenAccounts opens the treasury's and the central bank's settlement
+// accounts, which do not count towards their bank's deposits, and the
+// households' account.
+func (c *Country) OpenAccounts() {
+	t := &c.Treasury
+	b, err := c.commercialBank(t.BankCode)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	t.account = b.SettlementAccount("treasury")
+	c.households = bank.AccountRef{
+		CountryCode: c.Code,
+		BankCode:    t.BankCode,
+		AccountID:   uuid.New(),
+	}
+	if err := deposit(c.nc, t.account, t.Cash); err != nil {
+		log.Fatalln(err)
+	}
+	t.balance = toMinor(t.Cash)
+	c.openCentralBankAccount()
+	for _, b := range c.CommercialBanks {
+		b.SetPolicyRate(c.CentralBank.InterestRate.Value)
+	}
+}
+
+func (c *Country) SubscribeBonds(req micro.Request) {
+	s := payloads.BondSubscription{}
+	if err := json.Unmarshal(req.Data(), &s); err != nil {
+		respondError(req, "cannot parse request")
+		return
+	}
+	if s.Bonds <= 0 {
+		respondError(req, "must subscribe to at least one bond")
+		return
+	}
+	c.Treasury.mu.Lock()
+	c.Treasury.subscriptions = append(c.Treasury.subscriptions, s)
+	c.Treasury.mu.Unlock()
+	if err := req.RespondJSON(bank.Response{Status: "OK"}); err != nil {
+		log.Println(err)
+	}
+}
+
+func (c *Country) RunBudget(p payloads.WorldTick) payloads.Budget {
+	t := &c.Treasury
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	quarter := p.Quarters()
+	budget := payloads.Budget{
+		Currency:     c.Currency,
+		CurrencyUnit: bank.Minor,
+	}
+
+	revenue := toMinor(t.TaxRevenue)
+	if err := pay(c.nc, c.households, t.account, money(c.Currency, revenue)); err != nil {
+		log.Println(c.Code, err)
+	} else {
+		t.balance += revenue
+		budget.Revenue = revenue
+	}
+	budget.Tariffs = t.tariffs
+	budget.Revenue += t.tariffs
+	t.tariffs = 0
+
+	subsidies := c.subsidies()
+	for _, s := range subsidies {
+		budget.Subsidies += s
+	}
+	budget.PublicWages = toMinor(t.PublicWages)
+
+	existing := t.debt
+	outstanding := []*Bond{}
+	matured := []*Bond{}
+	for _, b := range existing {
+		budget.Interest += b.Coupon()
+		if b.Maturity <= quarter {
+			matured = append(matured, b)
+			budget.Redeemed += b.Face
+		} else {
+			outstanding = append(outstanding, b)
+		}
+	}
+	budget.Balance = budget.Revenue - budget.Subsidies - budget.PublicWages - budget.Interest
+
+	need := budget.Subsidies + budget.PublicWages + budget.Interest + budget.Redeemed
+	if need > t.balance {
+		budget.Issued = c.issueBonds(quarter, need-t.balance)
+	}
+
+	for company, s := range subsidies {
+		if err := pay(c.nc, t.account, company.account, money(c.Currency, s)); err != nil {
+			log.Println(err)
+			continue
+		}
+		t.balance -= s
+		company.receive(money(c.Currency, s), NonOperatingRevenueAccount, "subsidy")
+	}
+	if err := pay(c.nc, t.account, c.households, money(c.Currency, budget.PublicWages)); err != nil {
+		log.Println(err)
+	} else {
+		t.balance -= budget.PublicWages
+	}
+	for _, b := range existing {
+		if err := pay(c.nc, t.account, b.Holder, money(b.Currency, b.Coupon())); err != nil {
+			log.Println(err)
+			continue
+		}
+		t.balance -= b.Coupon()
+	}
+	for _, b := range matured {
+		if err := pay(c.nc, t.account, b.Holder, money(b.Currency, b.Face)); err != nil {
+			log.Println(err)
+			outstanding = append(outstanding, b)
+			continue
+		}
+		t.balance -= b.Face
+	}
+	t.debt = append(outstanding, t.debt[len(existing):]...)
+
+	budget.Debt = t.outstanding()
+	budget.GDP = toMinor(c.GDP)
+	if budget.GDP > 0 {
+		budget.DebtToGDP = float64(budget.Debt) / float64(budget.GDP) * 100
+	}
+	return budget
+}
+
+// collectTariff has the country's households pay a tariff on their imports
+// to the treasury. It is counted in the next budget's revenue.
+func (c *Country) collectTariff(v bank.CurrencyValue) error {
+	t := &c.Treasury
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if err := pay(c.nc, c.households, t.account, v); err != nil {
+		return err
+	}
+	t.balance += toMinor(v)
+	t.tariffs += toMinor(v)
+	return nil
+}
+
+// issueBonds sells enough bonds to raise at least amount, filling player
+// subscriptions first and spreading the remainder across the country's
+// commercial banks. It returns the face value actually sold.
+func (c *Country) issueBonds(quarter, amount int) int {
+	t := &c.Treasury
+	face := toMinor(t.Bonds.FaceValue)
+	if face <= 0 {
+		return 0
+	}
+	remaining := (amount + face - 1) / face
+	sold := 0
+	t.series++
+	series := fmt.Sprintf("%s-%d", c.Code, t.series)
+
+	sell := func(holder bank.AccountRef, bonds int) {
+		b := &Bond{
+			Series:     series,
+			Holder:     holder,
+			Currency:   c.Currency,
+			Face:       bonds * face,
+			CouponRate: t.Bonds.CouponRate,
+			Maturity:   quarter + t.Bonds.MaturityQuarters,
+		}
+		if err := pay(c.nc, holder, t.account, money(c.Currency, b.Face)); err != nil {
+			log.Println(err)
+			return
+		}
+		t.balance += b.Face
+		t.debt = append(t.debt, b)
+		remaining -= bonds
+		sold += b.Face
+	}
+
+	pending := []payloads.BondSubscription{}
+	for _, s := range t.subscriptions {
+		if remaining == 0 {
+			pending = append(pending, s)
+			continue
+		}
+		sell(s.Account, min(s.Bonds, remaining))
+	}
+	t.subscriptions = pending
+
+	for i, b := range c.CommercialBanks {
+		if remaining == 0 {
+			break
+		}
+		share := remaining / (len(c.CommercialBanks) - i)
+		if i == len(c.CommercialBanks)-1 {
+			share = remaining
+		}
+		if share > 0 {
+			sell(b.House(), share)
+		}
+	}
+	return sold
+}
+
+// reassign moves up to face of bonds from one holder to another, splitting
+// a holding if only part of it is needed. It returns the face value moved.
+func (t *Treasury) reassign(from, to bank.AccountRef, face int) int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	moved := 0
+	for _, b := range t.debt {
+		if moved == face {
+			break
+		}
+		if b.Holder != from {
+			continue
+		}
+		part := min(b.Face, face-moved)
+		if part < b.Face {
+			rest := *b
+			rest.Face = b.Face - part
+			t.debt = append(t.debt, &rest)
+			b.Face = part
+		}
+		b.Holder = to
+		moved += part
+	}
+	return moved
+}
+
+// held is the face value of bonds owned by one holder.
+func (t *Treasury) held(holder bank.AccountRef) int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	sum := 0
+	for _, b := range t.debt {
+		if b.Holder == holder {
+			sum += b.Face
+		}
+	}
+	return sum
+}
+
+func (t *Treasury) outstanding() int {
+	sum := 0
+	for _, b := range t.debt {
+		sum += b.Face
+	}
+	return sum
+}
+
+// subsidies splits each industry's subsidy evenly between the companies
+// headquartered in the country that operate primarily in that industry.
+func (c *Country) subsidies() map[*Company]int {
+	payments := map[*Company]int{}
+	for industry, amount := range c.Treasury.Subsidies {
+		recipients := []*Company{}
+		for _, company := range c.companies {
+			if company.Industries.IsPrimary(industry) {
+				recipients = append(recipients, company)
+			}
+		}
+		if len(recipients) == 0 {
+			continue
+		}
+		share := toMinor(amount) / len(recipients)
+		for _, company := range recipients {
+			payments[company] += share
+		}
+	}
+	return payments
+}
+
+func (t *Treasury) Update() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.TaxRevenue.Value += t.TaxRevenue.CalcUpdate()
+	t.PublicWages.Value += t.PublicWages.CalcUpdate()
+	for industry, amount := range t.Subsidies {
+		amount.Value += amount.CalcUpdate()
+		t.Subsidies[industry] = amount
+	}
+}
+
+func respondError(req micro.Request, errorMessage string) {
+	resp := bank.Response{
+		Status:  "Error",
+		Message: errorMessage,
+	}
+	if err := req.RespondJSON(resp); err != nil {
+		log.Println(err)
+	}
+}
@@ -0,0 +1,120 @@
+package world
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+
+	"github.com/jxlxx/GreenIsland/bank"
+)
+
+func TestBondCoupon(t *testing.T) {
+	tests := []struct {
+		name     string
+		face     int
+		rate     int
+		expected int
+	}{
+		{"four percent", 100000, 400, 1000},
+		{"zero coupon", 100000, 0, 0},
+		{"rounds down", 1000, 150, 3},
+		{"too small to pay", 100, 100, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := Bond{Face: tt.face, CouponRate: tt.rate}
+			if got := b.Coupon(); got != tt.expected {
+				t.Errorf("expected %d, got %d", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestSubsidies(t *testing.T) {
+	farm := &Company{Code: "FARM", Industries: Industries{PrimaryIndustries: []Industry{"agriculture"}}}
+	mill := &Company{Code: "MILL", Industries: Industries{PrimaryIndustries: []Industry{"agriculture", "manufacturing"}}}
+	lender := &Company{Code: "BANK", Industries: Industries{PrimaryIndustries: []Industry{"finance"}}}
+	tests := []struct {
+		name      string
+		subsidies map[Industry]int
+		expected  map[*Company]int
+	}{
+		{
+			name:      "none",
+			subsidies: map[Industry]int{},
+			expected:  map[*Company]int{},
+		},
+		{
+			name:      "split evenly",
+			subsidies: map[Industry]int{"agriculture": 1000},
+			expected:  map[*Company]int{farm: 500, mill: 500},
+		},
+		{
+			name:      "added up across industries",
+			subsidies: map[Industry]int{"agriculture": 1000, "manufacturing": 300},
+			expected:  map[*Company]int{farm: 500, mill: 800},
+		},
+		{
+			name:      "nobody in the industry",
+			subsidies: map[Industry]int{"mining": 1000},
+			expected:  map[*Company]int{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &Country{companies: []*Company{farm, mill, lender}}
+			c.Treasury.Subsidies = map[Industry]bank.CurrencyValue{}
+			for industry, v := range tt.subsidies {
+				c.Treasury.Subsidies[industry] = money("USD", v)
+			}
+			got := c.subsidies()
+			if len(got) != len(tt.expected) {
+				t.Fatalf("expected %v, got %v", tt.expected, got)
+			}
+			for company, v := range tt.expected {
+				if got[company] != v {
+					t.Errorf("%s: expected %d, got %d", company.Code, v, got[company])
+				}
+			}
+		})
+	}
+}
+
+func TestReassignBonds(t *testing.T) {
+	from := bank.AccountRef{AccountID: uuid.New()}
+	to := bank.AccountRef{AccountID: uuid.New()}
+	tests := []struct {
+		name     string
+		holdings []int
+		face     int
+		moved    int
+	}{
+		{"whole holding", []int{1000}, 1000, 1000},
+		{"split a holding", []int{1000}, 400, 400},
+		{"across holdings", []int{300, 300, 300}, 500, 500},
+		{"more than held", []int{300}, 500, 300},
+		{"nothing held", nil, 500, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tr := &Treasury{}
+			total := 0
+			for _, face := range tt.holdings {
+				tr.debt = append(tr.debt, &Bond{Holder: from, Face: face})
+				total += face
+			}
+			if got := tr.reassign(from, to, tt.face); got != tt.moved {
+				t.Errorf("expected %d moved, got %d", tt.moved, got)
+			}
+			if got := tr.held(to); got != tt.moved {
+				t.Errorf("expected %d held by the buyer, got %d", tt.moved, got)
+			}
+			if got := tr.held(from); got != total-tt.moved {
+				t.Errorf("expected %d left with the seller, got %d", total-tt.moved, got)
+			}
+			if got := tr.outstanding(); got != total {
+				t.Errorf("expected %d outstanding, got %d", total, got)
+			}
+		})
+	}
+}
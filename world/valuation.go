@@ -0,0 +1,100 @@
+package world
+
+import (
+	"log"
+	"math"
+
+	"github.com/jxlxx/GreenIsland/bank"
+)
+
+// Valuation blends a Gordon growth value of the dividend with the earnings
+// run rate capitalised at the required rate of return. DividendWeight is the
+// dividend model's share of fair value and Spread the distance between bid
+// and ask, both in basis points.
+type Valuation struct {
+	DividendWeight int `yaml:"dividend_weight"`
+	Spread         int `yaml:"spread"`
+}
+
+// projectedDividend is next quarter's expected dividend per share.
+func (c *Company) projectedDividend() bank.CurrencyValue {
+	m := c.QuarterlyMetrics
+	projected := m.ProjectedDividends
+	sum := toMicro(c.QuarterlyBehaviour.DividendPayout) + toMicro(m.DividendGrowthRate)
+	projected.Value = c.fromMicro(float64(max(0, sum)), projected.Unit)
+	return projected
+}
+
+// runRateEarnings is the quarter's earnings at the current run rate of
+// revenue and expenses, including supply contracts and subsidiaries, in
+// minor units.
+func (c *Company) runRateEarnings() int {
+	i := c.Income
+	wages := toMinor(c.Employment.AverageAnnualSalary) / 4 * c.Employment.Employees.Value
+	_, abroad := c.subsidiaryRunRate()
+	return toMinor(i.OperatingRevenue) + toMinor(i.NonOperatingRevenue) -
+		c.ownProduction() - toMinor(i.AdministrativeExpenses) - toMinor(i.Depreciation) -
+		wages - c.quarterlyInterest() + c.supplies - c.purchases + abroad
+}
+
+// runRateEPS is runRateEarnings per share in micro units.
+func (c *Company) runRateEPS() float64 {
+	if c.OutstandingShares <= 0 {
+		return 0
+	}
+	micro := toMicro(money(c.DefaultCurrency, 1))
+	return float64(c.runRateEarnings()) * float64(micro) / float64(c.OutstandingShares)
+}
+
+// fairValue is the value of one share in micro units after the last
+// earnings surprise, or zero if the required rate of return leaves it
+// undefined.
+func (c *Company) fairValue() float64 {
+	return c.surprisePremium(c.intrinsicValue())
+}
+
+func (c *Company) intrinsicValue() float64 {
+	r := float64(c.QuarterlyMetrics.RequiredRateOfReturn.Value) / 10000
+	if r <= 0 {
+		return 0
+	}
+	earnings := max(0, 4*c.runRateEPS()/r)
+
+	dividend := float64(toMicro(c.QuarterlyMetrics.ProjectedDividends))
+	growth := float64(toMicro(c.QuarterlyMetrics.DividendGrowthRate))
+	weight := float64(c.Valuation.DividendWeight) / 10000
+	if dividend <= 0 {
+		return earnings
+	}
+	g := 4 * growth / dividend
+	if g >= r {
+		return earnings
+	}
+	gordon := 4 * dividend / (r - g)
+	return weight*gordon + (1-weight)*earnings
+}
+
+func (c *Company) fromMicro(micro float64, unit bank.UnitType) int {
+	if unit == bank.Micro {
+		return int(math.Round(micro))
+	}
+	sum, err := bank.Convert(c.DefaultCurrency, bank.Micro, unit, int(math.Round(micro)))
+	if err != nil {
+		log.Println(err)
+	}
+	return sum
+}
+
+// UpdateBidAsk quotes around the fair value. Without one the quotes stand.
+func (c *Company) UpdateBidAsk() (bank.CurrencyValue, bank.CurrencyValue) {
+	fair := c.fairValue()
+	if fair <= 0 {
+		return c.Bid, c.Ask
+	}
+	c.QuarterlyMetrics.CurrentStockPrice.Value = c.fromMicro(fair, c.QuarterlyMetrics.CurrentStockPrice.Unit)
+	half := fair * float64(c.Valuation.Spread) / 20000
+	bid, ask := c.Bid, c.Ask
+	bid.Value = c.fromMicro(fair-half, bid.Unit)
+	ask.Value = c.fromMicro(fair+half, ask.Unit)
+	return bid, ask
+}
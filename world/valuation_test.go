@@ -0,0 +1,74 @@
+package world
+
+import (
+	"math"
+	"testing"
+
+	"github.com/jxlxx/GreenIsland/bank"
+	"github.com/jxlxx/GreenIsland/types"
+)
+
+func TestIntrinsicValue(t *testing.T) {
+	tests := []struct {
+		name     string
+		required int
+		revenue  int
+		expenses int
+		dividend int
+		growth   int
+		expected float64
+	}{
+		{"no required return", 0, 10000, 0, 0, 0, 0},
+		{"earnings only", 1000, 10000, 0, 0, 0, 400000},
+		{"losses are worth nothing", 1000, 0, 10000, 0, 0, 0},
+		{"blended with the dividend", 1000, 10000, 0, 5000, 0, 300000},
+		{"growing dividend", 1000, 10000, 0, 5000, 50, 366666.67},
+		{"growth at the required return", 1000, 10000, 0, 5000, 1250, 400000},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &Company{
+				DefaultCurrency:   "USD",
+				OutstandingShares: 100,
+				Valuation:         Valuation{DividendWeight: 5000},
+			}
+			c.Income.OperatingRevenue = money("USD", tt.revenue)
+			c.Income.AdministrativeExpenses = money("USD", tt.expenses)
+			c.QuarterlyMetrics.RequiredRateOfReturn = types.Value{Value: tt.required}
+			c.QuarterlyMetrics.ProjectedDividends = bank.CurrencyValue{Currency: "USD", Unit: bank.Micro, Value: tt.dividend}
+			c.QuarterlyMetrics.DividendGrowthRate = bank.CurrencyValue{Currency: "USD", Unit: bank.Micro, Value: tt.growth}
+			if got := c.intrinsicValue(); math.Abs(got-tt.expected) > 0.01 {
+				t.Errorf("expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestUpdateBidAsk(t *testing.T) {
+	tests := []struct {
+		name     string
+		required int
+		bid      int
+		ask      int
+	}{
+		{"quoted around fair value", 1000, 3960, 4040},
+		{"quotes stand without a fair value", 0, 100, 200},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &Company{
+				DefaultCurrency:   "USD",
+				OutstandingShares: 100,
+				Valuation:         Valuation{Spread: 200},
+				Bid:               money("USD", 100),
+				Ask:               money("USD", 200),
+			}
+			c.Income.OperatingRevenue = money("USD", 10000)
+			c.QuarterlyMetrics.RequiredRateOfReturn = types.Value{Value: tt.required}
+			bid, ask := c.UpdateBidAsk()
+			if bid.Value != tt.bid || ask.Value != tt.ask {
+				t.Errorf("expected %d/%d, got %d/%d", tt.bid, tt.ask, bid.Value, ask.Value)
+			}
+		})
+	}
+}
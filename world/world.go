@@ -4,17 +4,21 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"sync"
 	"time"
 
 	"github.com/nats-io/nats.go"
 	"github.com/nats-io/nats.go/micro"
 	"gopkg.in/yaml.v3"
 
+	"github.com/jxlxx/GreenIsland/broker"
 	"github.com/jxlxx/GreenIsland/config"
 	"github.com/jxlxx/GreenIsland/payloads"
 	"github.com/jxlxx/GreenIsland/subjects"
 )
 
+const brokerBucket = "broker"
+
 type World struct {
 	HourDuration     time.Duration
 	elaspsedRealTime time.Duration
@@ -23,18 +27,41 @@ type World struct {
 	totalHours       int
 	countries        []*Country
 	companies        []*Company
+	fx               *FXMarket
+	markets          []*Market
+	tenders          []*tender
+	contracts        []*supplyContract
+	invoices         []*invoice
+	broker           *broker.Broker
+	mu               sync.Mutex
+	foundMu          sync.Mutex
 	adminService     micro.Service
 }
 
 func New() *World {
 	countries := createCountries()
 	companies := createCompanies()
+	for _, country := range countries {
+		for _, company := range companies {
+			if company.HQCountryCode == country.Code {
+				country.companies = append(country.companies, company)
+				company.country = country
+			}
+			for _, s := range company.Subsidiaries {
+				if s.CountryCode == country.Code {
+					s.country = country
+				}
+			}
+		}
+	}
 
 	now := time.Now()
 	world := &World{
 		HourDuration:     time.Microsecond * 500,
 		countries:        countries,
 		companies:        companies,
+		fx:               createFXMarket(),
+		markets:          createMarkets(),
 		elaspsedRealTime: now.Sub(now),
 	}
 	return world
@@ -50,24 +77,73 @@ func (w *World) Connect() {
 			fmt.Println(err)
 		}
 		for _, b := range c.CommercialBanks {
-			b.Connect()
 			b.Setup()
+			b.Connect()
 		}
 	}
 
+	if _, err := w.nc.Subscribe(subjects.TickQuarter.String(), w.TradeSubscriber()); err != nil {
+		fmt.Println(err)
+	}
+	if _, err := w.nc.Subscribe(subjects.TickQuarter.String(), w.MigrationSubscriber()); err != nil {
+		fmt.Println(err)
+	}
+	if _, err := w.nc.Subscribe(subjects.TickDay.String(), w.MarketDailySubscriber()); err != nil {
+		fmt.Println(err)
+	}
+	if _, err := w.nc.Subscribe(subjects.TickDay.String(), w.SupplySubscriber()); err != nil {
+		fmt.Println(err)
+	}
+	if _, err := w.nc.Subscribe(subjects.TickQuarter.String(), w.MarketSubscriber()); err != nil {
+		fmt.Println(err)
+	}
+	if _, err := w.nc.Subscribe(subjects.TickHour.String(), w.FXSubscriber()); err != nil {
+		fmt.Println(err)
+	}
+
+	if _, err := w.nc.Subscribe(subjects.TickQuarter.String(), w.FoundingSubscriber()); err != nil {
+		fmt.Println(err)
+	}
+	if _, err := w.nc.Subscribe(subjects.TickDay.String(), w.TenderSubscriber()); err != nil {
+		fmt.Println(err)
+	}
+	if _, err := w.nc.Subscribe(subjects.TickQuarter.String(), w.RatingSubscriber()); err != nil {
+		fmt.Println(err)
+	}
+
+	w.broker = broker.New(brokerBucket)
 	for _, c := range w.companies {
-		if _, err := w.nc.Subscribe(subjects.TickDay.String(), c.DailySubscriber()); err != nil {
-			fmt.Println(err)
-		}
-		if _, err := w.nc.Subscribe(subjects.TickQuarter.String(), c.QuarterlySubscriber()); err != nil {
-			fmt.Println(err)
-		}
+		c.broker = w.broker
+		c.fx = w.fx
+		c.onClose = w.liquidated
+		c.households = w.households
+		w.subscribeCompany(c)
+	}
+}
+
+func (w *World) subscribeCompany(c *Company) {
+	daily, err := w.nc.Subscribe(subjects.TickDay.String(), c.DailySubscriber())
+	if err != nil {
+		fmt.Println(err)
+	}
+	quarterly, err := w.nc.Subscribe(subjects.TickQuarter.String(), c.QuarterlySubscriber())
+	if err != nil {
+		fmt.Println(err)
+	}
+	c.subs = []*nats.Subscription{daily, quarterly}
+}
+
+func (w *World) SetCountryBankAccounts() {
+	for _, c := range w.countries {
+		c.OpenAccounts()
 	}
 }
 
 func (w *World) SetCompanyBankAccounts() {
 	for _, c := range w.companies {
-		c.InitializeCompany()
+		if err := c.InitializeCompany(); err != nil {
+			log.Fatalln(err)
+		}
 	}
 }
 
@@ -90,11 +166,62 @@ func (w *World) AdminService(nc *nats.Conn) micro.Service {
 }
 
 func (w *World) AddEndpoints() {
+	g := w.adminService.AddGroup("admin.world.company")
+	if err := g.AddEndpoint("found", micro.HandlerFunc(w.FoundCompany)); err != nil {
+		log.Fatalln(err)
+	}
+	if err := g.AddEndpoint("list", micro.HandlerFunc(w.ListCompany)); err != nil {
+		log.Fatalln(err)
+	}
+	if err := g.AddEndpoint("tender", micro.HandlerFunc(w.TenderOffer)); err != nil {
+		log.Fatalln(err)
+	}
+	if err := g.AddEndpoint("fill", micro.HandlerFunc(w.FillOrder)); err != nil {
+		log.Fatalln(err)
+	}
+	if err := g.AddEndpoint("accept", micro.HandlerFunc(w.AcceptTender)); err != nil {
+		log.Fatalln(err)
+	}
+}
+
+func (w *World) TreasuryService(nc *nats.Conn) micro.Service {
+	conf := micro.Config{
+		Name:        "TreasuryService",
+		Version:     config.GetEnvOrDefault("VERSION", "0.0.1"),
+		Description: "Sovereign bond subscriptions for every country.",
+	}
+	srv, err := micro.AddService(nc, conf)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	for _, c := range w.countries {
+		g := srv.AddGroup(fmt.Sprintf("treasury.%s", c.Code))
+		if err := g.AddEndpoint("subscribe", micro.HandlerFunc(c.SubscribeBonds)); err != nil {
+			log.Fatalln(err)
+		}
+	}
+	return srv
+}
+
+func (w *World) FXService(nc *nats.Conn) micro.Service {
+	conf := micro.Config{
+		Name:        "FXService",
+		Version:     config.GetEnvOrDefault("VERSION", "0.0.1"),
+		Description: "Foreign exchange quotes between every currency.",
+	}
+	srv, err := micro.AddService(nc, conf)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	if err := srv.AddGroup("market.fx").AddEndpoint("quote", micro.HandlerFunc(w.Quote)); err != nil {
+		log.Fatalln(err)
+	}
+	return srv
 }
 
 func (w *World) AddServices(nc *nats.Conn) []micro.Service {
 	w.AdminService(nc)
-	services := []micro.Service{w.adminService}
+	services := []micro.Service{w.adminService, w.TreasuryService(nc), w.FXService(nc), w.RatingService(nc)}
 	for _, c := range w.countries {
 		for _, b := range c.CommercialBanks {
 			services = append(services, b.AddService(nc))
@@ -107,6 +234,7 @@ func (w *World) Initialize() {
 	for _, c := range w.countries {
 		c.Initialize()
 	}
+	broker.Initialize(brokerBucket)
 }
 
 func createCountries() []*Country {
@@ -125,15 +253,21 @@ func createCountries() []*Country {
 func createCompanies() []*Company {
 	files := []string{
 		"/data/companies/aerospin.yaml",
+		"/data/companies/northpeak.yaml",
 	}
 	companies := create(files, Company{})
 	for _, c := range companies {
-		nc := config.EncodedConnect()
-		c.nc = nc
+		prepareCompany(c)
 	}
 	return companies
 }
 
+func prepareCompany(c *Company) {
+	c.nc = config.EncodedConnect()
+	c.ledger = c.BalanceSheet.open(c.DefaultCurrency)
+	c.strategy = strategyFor(c.Strategy)
+}
+
 func create[T any](files []string, t T) []*T {
 	slice := []*T{}
 	for _, f := range files {